@@ -0,0 +1,162 @@
+package archive
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ChangeKind 文件改动的类型
+type ChangeKind string
+
+const (
+	ChangeAdd    ChangeKind = "A" // 新增
+	ChangeModify ChangeKind = "C" // 修改
+	ChangeDelete ChangeKind = "D" // 删除
+)
+
+// Change 相对于下层的一个改动，Path 是以 / 开头的绝对路径
+type Change struct {
+	Kind ChangeKind
+	Path string
+}
+
+func (c Change) String() string {
+	return string(c.Kind) + " " + c.Path
+}
+
+// OverlayChanges 对比 overlay 的 upper 目录和 lower 目录得到改动，lowerDirs 按照从上到下的顺序
+/*
+1）upper 中的 whiteout 表示删除了下层的文件
+2）upper 中的文件在下层不存在时是新增，存在时是修改
+3）不透明目录隐藏了下层同名目录中的所有内容，下层中存在而 upper 中没有的都是删除，
+   不透明目录中的子目录也不会再和下层合并
+*/
+func OverlayChanges(upper string, lowerDirs []string) ([]Change, error) {
+	var changes []Change
+	// replaced 不再和下层合并的目录
+	replaced := make(map[string]bool)
+	err := filepath.WalkDir(upper, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(upper, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		name := "/" + rel
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if IsOverlayWhiteout(fi) {
+			if !replaced[filepath.Dir(name)] && lookupLower(lowerDirs, name) != nil {
+				changes = append(changes, Change{Kind: ChangeDelete, Path: name})
+			}
+			return nil
+		}
+		lower := lookupLower(lowerDirs, name)
+		if lower == nil {
+			changes = append(changes, Change{Kind: ChangeAdd, Path: name})
+		} else {
+			changes = append(changes, Change{Kind: ChangeModify, Path: name})
+		}
+		if !fi.IsDir() {
+			return nil
+		}
+		if !replaced[filepath.Dir(name)] && !IsOverlayOpaque(p) {
+			return nil
+		}
+		replaced[name] = true
+		if lower == nil || !lower.IsDir() {
+			return nil
+		}
+		for _, child := range lowerNames(lowerDirs, name) {
+			if fi, err := os.Lstat(filepath.Join(p, child)); err == nil && !IsOverlayWhiteout(fi) {
+				continue
+			}
+			if lookupLower(lowerDirs, filepath.Join(name, child)) != nil {
+				changes = append(changes, Change{Kind: ChangeDelete, Path: filepath.Join(name, child)})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// lookupLower 获取路径在下层合并后可见的文件，不存在时返回 nil
+// 上层中的 whiteout、普通文件或者不透明目录会隐藏更下层中同名路径下的内容
+func lookupLower(lowerDirs []string, name string) os.FileInfo {
+	for _, layer := range lowerDirs {
+		blocked, opaque := hiddenInLayer(layer, name)
+		if blocked {
+			return nil
+		}
+		if fi, err := os.Lstat(filepath.Join(layer, name)); err == nil {
+			if IsOverlayWhiteout(fi) {
+				return nil
+			}
+			return fi
+		}
+		if opaque {
+			return nil
+		}
+	}
+	return nil
+}
+
+// hiddenInLayer 检查路径的父目录在层中的状态
+// blocked 表示父目录在这一层被删除或者不是目录，opaque 表示父目录在这一层是不透明目录，更下层的内容不可见
+func hiddenInLayer(layer, name string) (bool, bool) {
+	opaque := false
+	parent := layer
+	for _, part := range strings.Split(strings.Trim(filepath.Dir(name), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		parent = filepath.Join(parent, part)
+		fi, err := os.Lstat(parent)
+		if err != nil {
+			return false, opaque
+		}
+		if !fi.IsDir() {
+			return true, false
+		}
+		if IsOverlayOpaque(parent) {
+			opaque = true
+		}
+	}
+	return false, opaque
+}
+
+// lowerNames 列出各层中目录下的文件名，不检查是否可见
+func lowerNames(lowerDirs []string, dir string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, layer := range lowerDirs {
+		entries, err := os.ReadDir(filepath.Join(layer, dir))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,72 @@
+package archive
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestOverlayChanges(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("creating whiteouts and trusted xattrs requires root")
+	}
+	ast := assert.New(t)
+	write := func(dir, name string) {
+		ast.Nil(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		ast.Nil(os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+	whiteout := func(dir, name string) {
+		ast.Nil(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		ast.Nil(unix.Mknod(filepath.Join(dir, name), unix.S_IFCHR, int(unix.Mkdev(0, 0))))
+	}
+
+	// 下层：bottom 中的 etc/old 被 top 删除，opt 被 top 变为不透明目录
+	bottom, top, upper := t.TempDir(), t.TempDir(), t.TempDir()
+	write(bottom, "etc/hostname")
+	write(bottom, "etc/old")
+	write(bottom, "etc/passwd")
+	write(bottom, "opt/app/bin")
+	write(bottom, "var/lib/a")
+	write(bottom, "var/lib/b")
+	write(top, "opt/conf")
+	ast.Nil(unix.Setxattr(filepath.Join(top, "opt"), OverlayOpaqueXattr, []byte("y"), 0))
+	whiteout(top, "etc/old")
+
+	// 容器的改动
+	write(upper, "etc/hostname")
+	write(upper, "etc/hosts")
+	whiteout(upper, "etc/passwd")
+	// 删除下层中已经删除的文件不是改动
+	whiteout(upper, "etc/old")
+	write(upper, "opt/app/bin")
+	write(upper, "new/file")
+	// rm -rf /var/lib && mkdir -p /var/lib/c
+	write(upper, "var/lib/c")
+	ast.Nil(unix.Setxattr(filepath.Join(upper, "var/lib"), OverlayOpaqueXattr, []byte("y"), 0))
+
+	changes, err := OverlayChanges(upper, []string{top, bottom})
+	ast.Nil(err)
+	var lines []string
+	for _, change := range changes {
+		lines = append(lines, change.String())
+	}
+	ast.Equal([]string{
+		"C /etc",
+		"C /etc/hostname",
+		"A /etc/hosts",
+		"D /etc/passwd",
+		"A /new",
+		"A /new/file",
+		"C /opt",
+		"A /opt/app",
+		"A /opt/app/bin",
+		"C /var",
+		"C /var/lib",
+		"D /var/lib/a",
+		"D /var/lib/b",
+		"A /var/lib/c",
+	}, lines)
+}
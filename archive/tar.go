@@ -0,0 +1,210 @@
+package archive
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// paxXattrPrefix tar 中保存扩展属性的 PAX 记录前缀
+const paxXattrPrefix = "SCHILY.xattr."
+
+// TarOptions 打包选项
+type TarOptions struct {
+	// OverlayWhiteouts 把 overlay upper 目录中的 whiteout 转换为 OCI 的 .wh. 文件，用于生成镜像层
+	OverlayWhiteouts bool
+	// ExcludeContents 只打包这些目录本身，不打包目录中的内容，路径相对于打包的目录，用于跳过容器挂载的数据卷
+	ExcludeContents []string
+	// Name 不为空时 tar 中包含打包的目录本身，并以 Name 作为它的路径，此时打包的也可以是单个文件
+	Name string
+}
+
+// inode 用于识别硬链接
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// Tar 把目录打包成 tar 流，保留属主、权限、扩展属性、设备文件和硬链接
+// 读取方需要读完或者关闭返回的流
+func Tar(dir string, opts *TarOptions) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(WriteTar(pw, dir, opts))
+	}()
+	return pr
+}
+
+// WriteTar 把目录打包写入 w，tar 中的路径相对于 dir，指定了 Name 时为 Name 加上相对路径
+func WriteTar(w io.Writer, dir string, opts *TarOptions) error {
+	if opts == nil {
+		opts = new(TarOptions)
+	}
+	tw := tar.NewWriter(w)
+	links := make(map[inode]string)
+	excluded := make(map[string]bool)
+	for _, p := range opts.ExcludeContents {
+		excluded[filepath.Clean(strings.TrimLeft(p, "/"))] = true
+	}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." && opts.Name == "" {
+			return nil
+		}
+		name := filepath.Join(opts.Name, rel)
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if opts.OverlayWhiteouts && IsOverlayWhiteout(fi) {
+			whiteout := filepath.Join(filepath.Dir(name), WhiteoutPrefix+fi.Name())
+			return tw.WriteHeader(&tar.Header{Name: whiteout, Typeflag: tar.TypeReg, Mode: 0600, Format: tar.FormatPAX})
+		}
+		if err = writeEntry(tw, p, name, fi, links); err != nil {
+			return err
+		}
+		if opts.OverlayWhiteouts && fi.IsDir() && IsOverlayOpaque(p) {
+			opaque := filepath.Join(name, WhiteoutOpaqueDir)
+			if err = tw.WriteHeader(&tar.Header{Name: opaque, Typeflag: tar.TypeReg, Mode: 0600, Format: tar.FormatPAX}); err != nil {
+				return err
+			}
+		}
+		if fi.IsDir() && excluded[rel] {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// writeEntry 写入一个文件的 header 和内容
+func writeEntry(tw *tar.Writer, p, name string, fi os.FileInfo, links map[inode]string) error {
+	// tar 无法保存 socket
+	if fi.Mode()&os.ModeSocket != 0 {
+		return nil
+	}
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(p)
+		if err != nil {
+			return err
+		}
+		link = target
+	}
+	header, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+	if fi.IsDir() {
+		header.Name += "/"
+	}
+	// 只保存数字形式的属主，容器中的用户与宿主机无关
+	header.Uname, header.Gname = "", ""
+	// 不保存访问时间和状态变更时间，修改时间只保留到秒，内容相同的目录得到相同的 tar
+	header.AccessTime, header.ChangeTime = time.Time{}, time.Time{}
+	header.ModTime = header.ModTime.Truncate(time.Second)
+	header.Format = tar.FormatPAX
+	if err = readXattrs(p, header); err != nil {
+		return err
+	}
+
+	// 同一个 inode 第二次出现时记录为硬链接
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok && fi.Mode().IsRegular() && stat.Nlink > 1 {
+		key := inode{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}
+		if first, ok := links[key]; ok {
+			header.Typeflag, header.Linkname, header.Size = tar.TypeLink, first, 0
+			return tw.WriteHeader(header)
+		}
+		links[key] = header.Name
+	}
+
+	if err = tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	_, err = io.CopyN(tw, file, header.Size)
+	return err
+}
+
+// readXattrs 读取文件的扩展属性保存到 PAX 记录中，忽略 overlay 内部使用的扩展属性
+func readXattrs(p string, header *tar.Header) error {
+	names, err := listXattrs(p)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if strings.HasPrefix(name, overlayXattrPrefix) {
+			continue
+		}
+		value, err := getXattr(p, name)
+		if err != nil {
+			return err
+		}
+		if header.PAXRecords == nil {
+			header.PAXRecords = make(map[string]string)
+		}
+		header.PAXRecords[paxXattrPrefix+name] = string(value)
+	}
+	return nil
+}
+
+func listXattrs(p string) ([]string, error) {
+	size, err := unix.Llistxattr(p, nil)
+	if err != nil || size == 0 {
+		// 文件系统不支持扩展属性时忽略
+		if err == unix.ENOTSUP {
+			err = nil
+		}
+		return nil, err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(p, buf); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(string(buf[:size]), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func getXattr(p, name string) ([]byte, error) {
+	size, err := unix.Lgetxattr(p, name, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	if size, err = unix.Lgetxattr(p, name, value); err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
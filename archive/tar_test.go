@@ -0,0 +1,221 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+// readTar 读取 tar 中的所有 header 和普通文件的内容
+func readTar(t *testing.T, r io.Reader) (map[string]*tar.Header, map[string]string) {
+	headers := make(map[string]*tar.Header)
+	contents := make(map[string]string)
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		headers[header.Name] = header
+		content, err := io.ReadAll(tr)
+		assert.Nil(t, err)
+		contents[header.Name] = string(content)
+	}
+	return headers, contents
+}
+
+func TestTar(t *testing.T) {
+	ast := assert.New(t)
+	dir := t.TempDir()
+	ast.Nil(os.MkdirAll(filepath.Join(dir, "etc"), 0755))
+	ast.Nil(os.WriteFile(filepath.Join(dir, "etc/hostname"), []byte("mydocker"), 0644))
+	ast.Nil(os.Link(filepath.Join(dir, "etc/hostname"), filepath.Join(dir, "etc/name")))
+	ast.Nil(os.Symlink("hostname", filepath.Join(dir, "etc/link")))
+
+	reader := Tar(dir, nil)
+	headers, contents := readTar(t, reader)
+	ast.Nil(reader.Close())
+
+	ast.Equal(byte(tar.TypeDir), headers["etc/"].Typeflag)
+	ast.Equal("mydocker", contents["etc/hostname"])
+	ast.Equal(byte(tar.TypeLink), headers["etc/name"].Typeflag)
+	ast.Equal("etc/hostname", headers["etc/name"].Linkname)
+	ast.Equal(byte(tar.TypeSymlink), headers["etc/link"].Typeflag)
+	ast.Equal("hostname", headers["etc/link"].Linkname)
+	ast.Equal("", headers["etc/hostname"].Uname)
+
+	// 排除目录中的内容
+	headers, _ = readTar(t, Tar(dir, &TarOptions{ExcludeContents: []string{"/etc"}}))
+	ast.Contains(headers, "etc/")
+	ast.NotContains(headers, "etc/hostname")
+
+	// 包含打包的目录本身，也可以打包单个文件
+	headers, _ = readTar(t, Tar(filepath.Join(dir, "etc"), &TarOptions{Name: "conf"}))
+	ast.Contains(headers, "conf/")
+	ast.Contains(headers, "conf/hostname")
+	headers, contents = readTar(t, Tar(filepath.Join(dir, "etc/hostname"), &TarOptions{Name: "name"}))
+	ast.Len(headers, 1)
+	ast.Equal("mydocker", contents["name"])
+}
+
+func TestTarOverlayWhiteouts(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("creating whiteouts and trusted xattrs requires root")
+	}
+	ast := assert.New(t)
+	dir := t.TempDir()
+	ast.Nil(unix.Mknod(filepath.Join(dir, "deleted"), unix.S_IFCHR, int(unix.Mkdev(0, 0))))
+	ast.Nil(unix.Mknod(filepath.Join(dir, "null"), unix.S_IFCHR|0666, int(unix.Mkdev(1, 3))))
+	ast.Nil(os.Mkdir(filepath.Join(dir, "opaque"), 0755))
+	ast.Nil(unix.Setxattr(filepath.Join(dir, "opaque"), OverlayOpaqueXattr, []byte("y"), 0))
+	ast.Nil(unix.Setxattr(filepath.Join(dir, "opaque"), "trusted.mydocker", []byte("v"), 0))
+
+	headers, _ := readTar(t, Tar(dir, &TarOptions{OverlayWhiteouts: true}))
+	ast.Contains(headers, ".wh.deleted")
+	ast.NotContains(headers, "deleted")
+	ast.Contains(headers, "opaque/.wh..wh..opq")
+	ast.Equal("v", headers["opaque/"].PAXRecords[paxXattrPrefix+"trusted.mydocker"])
+	ast.NotContains(headers["opaque/"].PAXRecords, paxXattrPrefix+OverlayOpaqueXattr)
+	// 其他设备文件正常保存
+	ast.Equal(byte(tar.TypeChar), headers["null"].Typeflag)
+	ast.Equal(int64(1), headers["null"].Devmajor)
+	ast.Equal(int64(3), headers["null"].Devminor)
+
+	// 不转换时 whiteout 作为普通的设备文件保存
+	headers, _ = readTar(t, Tar(dir, nil))
+	ast.Equal(byte(tar.TypeChar), headers["deleted"].Typeflag)
+}
+
+func TestUntar(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("restoring owners and device nodes requires root")
+	}
+	ast := assert.New(t)
+	src := t.TempDir()
+	ast.Nil(os.MkdirAll(filepath.Join(src, "etc"), 0750))
+	ast.Nil(os.WriteFile(filepath.Join(src, "etc/hostname"), []byte("mydocker"), 0640))
+	ast.Nil(os.Lchown(filepath.Join(src, "etc/hostname"), 1000, 1000))
+	ast.Nil(os.Link(filepath.Join(src, "etc/hostname"), filepath.Join(src, "etc/name")))
+	ast.Nil(os.Symlink("/etc/hostname", filepath.Join(src, "link")))
+	ast.Nil(unix.Mknod(filepath.Join(src, "null"), unix.S_IFCHR|0666, int(unix.Mkdev(1, 3))))
+	ast.Nil(unix.Setxattr(filepath.Join(src, "etc/hostname"), "trusted.mydocker", []byte("v"), 0))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	ast.Nil(os.Chtimes(filepath.Join(src, "etc"), mtime, mtime))
+
+	dest := t.TempDir()
+	ast.Nil(Untar(Tar(src, nil), dest, nil))
+
+	var stat unix.Stat_t
+	ast.Nil(unix.Lstat(filepath.Join(dest, "etc/hostname"), &stat))
+	ast.Equal(uint32(1000), stat.Uid)
+	ast.Equal(uint32(0640), stat.Mode&07777)
+	ast.Equal(uint64(2), uint64(stat.Nlink))
+	value := make([]byte, 1)
+	_, err := unix.Lgetxattr(filepath.Join(dest, "etc/name"), "trusted.mydocker", value)
+	ast.Nil(err)
+	ast.Equal("v", string(value))
+	link, err := os.Readlink(filepath.Join(dest, "link"))
+	ast.Nil(err)
+	ast.Equal("/etc/hostname", link)
+	ast.Nil(unix.Lstat(filepath.Join(dest, "null"), &stat))
+	ast.Equal(uint32(unix.S_IFCHR), stat.Mode&unix.S_IFMT)
+	ast.Equal(unix.Mkdev(1, 3), uint64(stat.Rdev))
+	info, err := os.Stat(filepath.Join(dest, "etc"))
+	ast.Nil(err)
+	ast.True(info.ModTime().Equal(mtime))
+	ast.Equal(os.FileMode(0750), info.Mode().Perm())
+}
+
+func TestUntarOCIWhiteouts(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("creating whiteouts and trusted xattrs requires root")
+	}
+	ast := assert.New(t)
+	dest := t.TempDir()
+	layer := newTar(t,
+		&tar.Header{Name: "d/", Typeflag: tar.TypeDir, Mode: 0755},
+		&tar.Header{Name: "d/" + WhiteoutOpaqueDir, Typeflag: tar.TypeReg},
+		&tar.Header{Name: WhiteoutPrefix + "a", Typeflag: tar.TypeReg},
+		&tar.Header{Name: WhiteoutMetaPrefix + ".plnk", Typeflag: tar.TypeReg},
+	)
+	ast.Nil(Untar(bytes.NewReader(layer), dest, &UntarOptions{OCIWhiteouts: true}))
+
+	var stat unix.Stat_t
+	ast.Nil(unix.Lstat(filepath.Join(dest, "a"), &stat))
+	ast.Equal(uint32(unix.S_IFCHR), stat.Mode&unix.S_IFMT)
+	ast.Equal(uint64(0), uint64(stat.Rdev))
+	ast.True(IsOverlayOpaque(filepath.Join(dest, "d")))
+	entries, err := os.ReadDir(dest)
+	ast.Nil(err)
+	ast.Len(entries, 2)
+
+	// 转换后再打包得到原来的 whiteout
+	headers, _ := readTar(t, Tar(dest, &TarOptions{OverlayWhiteouts: true}))
+	ast.Contains(headers, WhiteoutPrefix+"a")
+	ast.Contains(headers, "d/"+WhiteoutOpaqueDir)
+
+	// 目录替换 whiteout 时标记为不透明目录
+	ast.Nil(Untar(bytes.NewReader(newTar(t, &tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755})),
+		dest, &UntarOptions{OpaqueWhiteoutDirs: true}))
+	info, err := os.Lstat(filepath.Join(dest, "a"))
+	ast.Nil(err)
+	ast.True(info.IsDir())
+	ast.True(IsOverlayOpaque(filepath.Join(dest, "a")))
+}
+
+func TestUntarBreakout(t *testing.T) {
+	ast := assert.New(t)
+	outside := t.TempDir()
+	cases := [][]*tar.Header{
+		{{Name: "../escape", Typeflag: tar.TypeReg}},
+		{{Name: "a/../../escape", Typeflag: tar.TypeReg}},
+		// 先创建指向外部的符号链接，再通过它写文件
+		{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: outside}, {Name: "link/escape", Typeflag: tar.TypeReg}},
+		{{Name: "hard", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"}},
+	}
+	for _, headers := range cases {
+		dest := t.TempDir()
+		ast.NotNil(Untar(bytes.NewReader(newTar(t, headers...)), dest, nil), headers[len(headers)-1].Name)
+	}
+	entries, err := os.ReadDir(outside)
+	ast.Nil(err)
+	ast.Empty(entries)
+
+	// whiteout 不能删除解压目录本身或者它以外的文件
+	for _, name := range []string{WhiteoutPrefix + ".", WhiteoutPrefix + "..", "a/" + WhiteoutPrefix + ".."} {
+		root := t.TempDir()
+		dest := filepath.Join(root, "dest")
+		ast.Nil(os.MkdirAll(filepath.Join(dest, "a"), 0755))
+		ast.Nil(os.WriteFile(filepath.Join(root, "sibling"), nil, 0644))
+		ast.NotNil(Untar(bytes.NewReader(newTar(t, &tar.Header{Name: name, Typeflag: tar.TypeReg})), dest, &UntarOptions{OCIWhiteouts: true}), name)
+		_, err = os.Stat(filepath.Join(root, "sibling"))
+		ast.Nil(err, name)
+		_, err = os.Stat(filepath.Join(dest, "a"))
+		ast.Nil(err, name)
+	}
+
+	// 开头的 / 去掉后解压到目标目录中
+	dest := t.TempDir()
+	ast.Nil(Untar(bytes.NewReader(newTar(t, &tar.Header{Name: "/abs", Typeflag: tar.TypeReg, Mode: 0644})), dest, nil))
+	_, err = os.Stat(filepath.Join(dest, "abs"))
+	ast.Nil(err)
+}
+
+// newTar 按顺序生成只有 header 的 tar
+func newTar(t *testing.T, headers ...*tar.Header) []byte {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, header := range headers {
+		assert.Nil(t, tw.WriteHeader(header))
+	}
+	assert.Nil(t, tw.Close())
+	return buf.Bytes()
+}
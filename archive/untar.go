@@ -0,0 +1,259 @@
+package archive
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// UntarOptions 解压选项
+type UntarOptions struct {
+	// OCIWhiteouts 把 OCI 的 .wh. 文件转换为 overlay 的 whiteout，用于解压镜像层：
+	// .wh.{name} 转换为名为 {name} 的 0/0 字符设备，.wh..wh..opq 转换为父目录的 trusted.overlay.opaque=y 扩展属性
+	OCIWhiteouts bool
+	// OpaqueWhiteoutDirs 目录替换 overlay 的 whiteout 时标记为不透明目录，用于直接写入容器的 upper 目录，
+	// 被删除的下层目录中的内容仍然保持删除
+	OpaqueWhiteoutDirs bool
+}
+
+// Untar 把 tar 流解压到 dir，还原属主、权限、修改时间、扩展属性、设备文件和硬链接
+// tar 中的路径不能超出 dir，也不能通过已经解压的符号链接写到 dir 以外
+func Untar(r io.Reader, dir string, opts *UntarOptions) error {
+	if opts == nil {
+		opts = new(UntarOptions)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	var dirs []*tar.Header
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// pax 全局扩展头只包含元数据
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		name, err := cleanName(header.Name)
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			continue
+		}
+		// 父目录不能是符号链接，否则可以通过先创建指向外部的符号链接把文件写到 dir 以外
+		if err = checkParents(dir, name); err != nil {
+			return err
+		}
+		target := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		base := filepath.Base(name)
+		if opts.OCIWhiteouts && strings.HasPrefix(base, WhiteoutPrefix) {
+			if err = applyWhiteout(dir, target, base); err != nil {
+				return err
+			}
+			continue
+		}
+		opaque := false
+		if opts.OpaqueWhiteoutDirs && header.Typeflag == tar.TypeDir {
+			if info, err := os.Lstat(target); err == nil && IsOverlayWhiteout(info) {
+				opaque = true
+			}
+		}
+		if err = createEntry(tr, header, dir, target); err != nil {
+			return fmt.Errorf("extract %s error, %v", header.Name, err)
+		}
+		if opaque {
+			if err = unix.Setxattr(target, OverlayOpaqueXattr, []byte("y"), 0); err != nil {
+				return fmt.Errorf("set opaque xattr on %s error, %v", target, err)
+			}
+		}
+		if header.Typeflag == tar.TypeLink {
+			continue
+		}
+		if err = applyMetadata(header, target); err != nil {
+			return fmt.Errorf("extract %s error, %v", header.Name, err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			header.Name = target
+			dirs = append(dirs, header)
+		}
+	}
+
+	// 解压目录中的文件会修改目录的修改时间，最后再还原
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := setTimes(dirs[i].Name, dirs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanName 规范 tar 中的路径，去掉开头的 /，不允许通过 .. 超出解压目录
+func cleanName(name string) (string, error) {
+	cleaned := filepath.Clean(strings.TrimLeft(name, "/"))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("invalid path %s in tar, outside of the target directory", name)
+	}
+	return cleaned, nil
+}
+
+// checkParents 检查 name 的每一级父目录都不是符号链接
+func checkParents(dir, name string) error {
+	parent := dir
+	for _, part := range strings.Split(filepath.Dir(name), string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		parent = filepath.Join(parent, part)
+		info, err := os.Lstat(parent)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("invalid path %s in tar, parent is a symlink", name)
+		}
+	}
+	return nil
+}
+
+// applyWhiteout 把 OCI 的 whiteout 文件转换为 overlay 的格式
+// .wh. 后面的文件名不能是空、. 或者 ..，否则会删除解压目录本身或者它以外的文件
+func applyWhiteout(dir, target, base string) error {
+	parent := filepath.Dir(target)
+	if base == WhiteoutOpaqueDir {
+		if err := unix.Setxattr(parent, OverlayOpaqueXattr, []byte("y"), 0); err != nil {
+			return fmt.Errorf("set opaque xattr on %s error, %v", parent, err)
+		}
+		return nil
+	}
+	// aufs 使用的其他元数据文件，overlay 不需要
+	if strings.HasPrefix(base, WhiteoutMetaPrefix) {
+		return nil
+	}
+	name := strings.TrimPrefix(base, WhiteoutPrefix)
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid whiteout %s in tar", target)
+	}
+	whiteout := filepath.Join(parent, name)
+	if rel, err := filepath.Rel(dir, whiteout); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+		return fmt.Errorf("invalid whiteout %s in tar, outside of the target directory", target)
+	}
+	if err := os.RemoveAll(whiteout); err != nil {
+		return err
+	}
+	if err := unix.Mknod(whiteout, unix.S_IFCHR, int(unix.Mkdev(0, 0))); err != nil {
+		return fmt.Errorf("create whiteout %s error, %v", whiteout, err)
+	}
+	return nil
+}
+
+// createEntry 创建文件，已经存在的同名文件先删除，同名目录保留并合并
+func createEntry(tr *tar.Reader, header *tar.Header, dir, target string) error {
+	if info, err := os.Lstat(target); err == nil {
+		if !(info.IsDir() && header.Typeflag == tar.TypeDir) {
+			if err = os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(target, 0755)
+	case tar.TypeReg:
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(file, tr); err != nil {
+			_ = file.Close()
+			return err
+		}
+		return file.Close()
+	case tar.TypeSymlink:
+		return os.Symlink(header.Linkname, target)
+	case tar.TypeLink:
+		// 硬链接的源文件必须是已经解压到 dir 中的文件
+		linkName, err := cleanName(header.Linkname)
+		if err != nil {
+			return err
+		}
+		if err = checkParents(dir, linkName); err != nil {
+			return err
+		}
+		return os.Link(filepath.Join(dir, linkName), target)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		mode := uint32(header.Mode & 07777)
+		switch header.Typeflag {
+		case tar.TypeChar:
+			mode |= unix.S_IFCHR
+		case tar.TypeBlock:
+			mode |= unix.S_IFBLK
+		default:
+			mode |= unix.S_IFIFO
+		}
+		return unix.Mknod(target, mode, int(unix.Mkdev(uint32(header.Devmajor), uint32(header.Devminor))))
+	default:
+		return fmt.Errorf("unsupported tar entry type %q", header.Typeflag)
+	}
+}
+
+// applyMetadata 还原属主、权限、扩展属性和修改时间，chown 会清除 setuid 位，所以需要在 chmod 之前
+func applyMetadata(header *tar.Header, target string) error {
+	if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+		return err
+	}
+	for key, value := range header.PAXRecords {
+		name, ok := strings.CutPrefix(key, paxXattrPrefix)
+		if !ok {
+			continue
+		}
+		if err := unix.Lsetxattr(target, name, []byte(value), 0); err != nil {
+			return fmt.Errorf("set xattr %s error, %v", name, err)
+		}
+	}
+	if header.Typeflag == tar.TypeSymlink {
+		return setTimes(target, header)
+	}
+	if err := unix.Chmod(target, uint32(header.Mode&07777)); err != nil {
+		return err
+	}
+	return setTimes(target, header)
+}
+
+// setTimes 设置访问时间和修改时间，不跟随符号链接
+func setTimes(target string, header *tar.Header) error {
+	atime := header.AccessTime
+	if atime.IsZero() {
+		atime = header.ModTime
+	}
+	times := []unix.Timespec{timespec(atime), timespec(header.ModTime)}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, target, times, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+func timespec(t time.Time) unix.Timespec {
+	if t.IsZero() {
+		return unix.Timespec{Nsec: unix.UTIME_OMIT}
+	}
+	return unix.NsecToTimespec(t.UnixNano())
+}
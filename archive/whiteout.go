@@ -0,0 +1,36 @@
+package archive
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// OCI 层中的 whiteout 文件
+// .wh.{name} 表示删除下层的 {name}，目录中的 .wh..wh..opq 表示隐藏下层同名目录中的所有内容
+const (
+	WhiteoutPrefix     = ".wh."
+	WhiteoutMetaPrefix = WhiteoutPrefix + WhiteoutPrefix
+	WhiteoutOpaqueDir  = WhiteoutMetaPrefix + ".opq"
+	// OverlayOpaqueXattr overlay 通过目录的这个扩展属性表示不透明目录
+	OverlayOpaqueXattr = "trusted.overlay.opaque"
+	// overlayXattrPrefix overlay 内部使用的扩展属性，打包时不需要保留
+	overlayXattrPrefix = "trusted.overlay."
+)
+
+// IsOverlayWhiteout 判断是否是 overlay 的 whiteout，即 0/0 字符设备
+func IsOverlayWhiteout(fi os.FileInfo) bool {
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	stat, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && stat.Rdev == 0
+}
+
+// IsOverlayOpaque 判断目录是否是 overlay 的不透明目录
+func IsOverlayOpaque(dir string) bool {
+	value := make([]byte, 1)
+	n, err := unix.Lgetxattr(dir, OverlayOpaqueXattr, value)
+	return err == nil && n == 1 && value[0] == 'y'
+}
@@ -1,57 +1,29 @@
 package cgroups
 
 import (
-	"fmt"
+	"github.com/sirupsen/logrus"
+
 	"github.com/pjimming/mydocker/cgroups/subsystems"
-	"strings"
 )
 
-type CgroupManager struct {
-	Path string
-}
-
-func NewCgroupManager(path string) *CgroupManager {
-	return &CgroupManager{Path: path}
-}
-
-func (c *CgroupManager) Apply(pid int, res *subsystems.ResourceConfig) error {
-	var errMsg []string
-	for _, subsys := range subsystems.Ins {
-		if err := subsys.Apply(c.Path, pid, res); err != nil {
-			errMsg = append(errMsg, err.Error())
-		}
-	}
-
-	if len(errMsg) > 0 {
-		return fmt.Errorf("%s", strings.Join(errMsg, ", "))
-	}
-	return nil
+// CgroupManager 管理容器的cgroup，屏蔽 cgroup v1 和 cgroup v2 的差异
+type CgroupManager interface {
+	// Apply 将进程加入到cgroup中
+	Apply(pid int, res *subsystems.ResourceConfig) error
+	// Set 设置cgroup的资源限制
+	Set(res *subsystems.ResourceConfig) error
+	// Destroy 释放cgroup
+	Destroy() error
+	// OOMKilled 判断cgroup内是否有进程因为内存超限被杀死
+	OOMKilled() (bool, error)
 }
 
-func (c *CgroupManager) Set(res *subsystems.ResourceConfig) error {
-	var errMsg []string
-	for _, subsys := range subsystems.Ins {
-		if err := subsys.Set(c.Path, res); err != nil {
-			errMsg = append(errMsg, err.Error())
-		}
-	}
-
-	if len(errMsg) > 0 {
-		return fmt.Errorf("%s", strings.Join(errMsg, ", "))
-	}
-	return nil
-}
-
-func (c *CgroupManager) Destroy() error {
-	var errMsg []string
-	for _, subsys := range subsystems.Ins {
-		if err := subsys.Remove(c.Path); err != nil {
-			errMsg = append(errMsg, err.Error())
-		}
-	}
-
-	if len(errMsg) > 0 {
-		return fmt.Errorf("%s", strings.Join(errMsg, ", "))
+// NewCgroupManager 根据宿主机挂载的cgroup版本创建对应的 CgroupManager
+func NewCgroupManager(path string) CgroupManager {
+	if IsCgroup2UnifiedMode() {
+		logrus.Debugf("use cgroup v2 manager")
+		return newCgroupManagerV2(path)
 	}
-	return nil
+	logrus.Debugf("use cgroup v1 manager")
+	return newCgroupManagerV1(path)
 }
@@ -0,0 +1,75 @@
+package fs2
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pjimming/mydocker/cgroups/subsystems"
+)
+
+const cpuSubsystem = "cpu"
+
+type CpuSubsystem struct {
+}
+
+func (s *CpuSubsystem) CgroupFileName() string {
+	return "cpu.weight"
+}
+
+func (s *CpuSubsystem) Name() string {
+	return cpuSubsystem
+}
+
+func (s *CpuSubsystem) Set(cgroupPath string, res *subsystems.ResourceConfig) error {
+	if res.CpuShare != "" {
+		shares, err := strconv.ParseUint(res.CpuShare, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid cpu share %s, %v", res.CpuShare, err)
+		}
+		weight := convertCPUSharesToWeight(shares)
+		if err = setCgroup(cgroupPath, s.CgroupFileName(), strconv.FormatUint(weight, 10)); err != nil {
+			return err
+		}
+	}
+
+	if res.CpuCfsQuota > 0 {
+		if err := setCgroup(cgroupPath, "cpu.max", cpuMax(res.CpuCfsQuota)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CpuSubsystem) Apply(cgroupPath string, pid int, res *subsystems.ResourceConfig) error {
+	if res.CpuShare == "" && res.CpuCfsQuota <= 0 {
+		return nil
+	}
+
+	return applyCgroup(cgroupPath, pid)
+}
+
+func (s *CpuSubsystem) Remove(cgroupPath string) error {
+	return removeCgroup(cgroupPath)
+}
+
+// cpuMax 把 CPU 使用率上限转换为 cpu.max 的内容
+// cpu.max 格式为 "$MAX $PERIOD"，对应 v1 的 cpu.cfs_quota_us 和 cpu.cfs_period_us
+func cpuMax(percent int) string {
+	quota := subsystems.PeriodDefault / subsystems.Percent * percent
+	return fmt.Sprintf("%d %d", quota, subsystems.PeriodDefault)
+}
+
+// convertCPUSharesToWeight 将 v1 的 cpu.shares [2, 262144] 线性映射为 v2 的 cpu.weight [1, 10000]
+// 与 runc 的转换方式保持一致，默认的 1024 对应 39
+func convertCPUSharesToWeight(shares uint64) uint64 {
+	if shares == 0 {
+		return 0
+	}
+	if shares < 2 {
+		shares = 2
+	}
+	if shares > 262144 {
+		shares = 262144
+	}
+	return 1 + ((shares-2)*9999)/262142
+}
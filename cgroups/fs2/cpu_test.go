@@ -0,0 +1,25 @@
+package fs2
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertCPUSharesToWeight(t *testing.T) {
+	ast := assert.New(t)
+
+	ast.Equal(uint64(0), convertCPUSharesToWeight(0))
+	ast.Equal(uint64(1), convertCPUSharesToWeight(2))
+	ast.Equal(uint64(39), convertCPUSharesToWeight(1024))
+	ast.Equal(uint64(10000), convertCPUSharesToWeight(262144))
+	ast.Equal(uint64(10000), convertCPUSharesToWeight(1<<20))
+}
+
+func TestCpuMax(t *testing.T) {
+	ast := assert.New(t)
+
+	ast.Equal("50000 100000", cpuMax(50))
+	ast.Equal("100000 100000", cpuMax(100))
+	ast.Equal("200000 100000", cpuMax(200))
+}
@@ -0,0 +1,36 @@
+package fs2
+
+import "github.com/pjimming/mydocker/cgroups/subsystems"
+
+const cpusetSubsystem = "cpuset"
+
+type CpusetSubsystem struct {
+}
+
+func (s *CpusetSubsystem) CgroupFileName() string {
+	return "cpuset.cpus"
+}
+
+func (s *CpusetSubsystem) Name() string {
+	return cpusetSubsystem
+}
+
+func (s *CpusetSubsystem) Set(cgroupPath string, res *subsystems.ResourceConfig) error {
+	if res.CpuSet == "" {
+		return nil
+	}
+
+	return setCgroup(cgroupPath, s.CgroupFileName(), res.CpuSet)
+}
+
+func (s *CpusetSubsystem) Apply(cgroupPath string, pid int, res *subsystems.ResourceConfig) error {
+	if res.CpuSet == "" {
+		return nil
+	}
+
+	return applyCgroup(cgroupPath, pid)
+}
+
+func (s *CpusetSubsystem) Remove(cgroupPath string) error {
+	return removeCgroup(cgroupPath)
+}
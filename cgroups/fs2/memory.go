@@ -0,0 +1,56 @@
+package fs2
+
+import (
+	"os"
+	"path"
+
+	"github.com/pjimming/mydocker/cgroups/subsystems"
+)
+
+const memorySubsystem = "memory"
+
+type MemorySubsystem struct {
+}
+
+func (s *MemorySubsystem) CgroupFileName() string {
+	return "memory.max"
+}
+
+func (s *MemorySubsystem) Name() string {
+	return memorySubsystem
+}
+
+func (s *MemorySubsystem) Set(cgroupPath string, res *subsystems.ResourceConfig) error {
+	if res.MemoryLimit == "" {
+		return nil
+	}
+
+	// memory.max 与 v1 的 memory.limit_in_bytes 一样支持 100m 这样带单位的写法
+	return setCgroup(cgroupPath, s.CgroupFileName(), res.MemoryLimit)
+}
+
+func (s *MemorySubsystem) Apply(cgroupPath string, pid int, res *subsystems.ResourceConfig) error {
+	if res.MemoryLimit == "" {
+		return nil
+	}
+
+	return applyCgroup(cgroupPath, pid)
+}
+
+func (s *MemorySubsystem) Remove(cgroupPath string) error {
+	return removeCgroup(cgroupPath)
+}
+
+// OOMKillCount 读取 memory.events 中的 oom_kill 计数，即 cgroup 内因为内存超限被杀死的进程数
+func (s *MemorySubsystem) OOMKillCount(cgroupPath string) (uint64, error) {
+	absPath, err := getCgroupPath(cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+	content, err := os.ReadFile(path.Join(absPath, "memory.events"))
+	if err != nil {
+		return 0, err
+	}
+	count, _ := subsystems.ParseKeyValue(string(content), "oom_kill")
+	return count, nil
+}
@@ -0,0 +1,14 @@
+package fs2
+
+import "github.com/pjimming/mydocker/cgroups/subsystems"
+
+// UnifiedMountpoint cgroup v2 (unified hierarchy) 的挂载点
+// 与 v1 不同，v2 所有的 subsystem(controller) 都挂载在同一个 hierarchy 上
+const UnifiedMountpoint = "/sys/fs/cgroup"
+
+// Ins cgroup v2 下支持的 controller，实现与 v1 相同的 Subsystem 接口
+var Ins = []subsystems.Subsystem{
+	&MemorySubsystem{},
+	&CpuSubsystem{},
+	&CpusetSubsystem{},
+}
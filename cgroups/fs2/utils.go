@@ -0,0 +1,111 @@
+package fs2
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+func getCgroupPath(cgroupPath string, autoCreate bool) (string, error) {
+	absPath := path.Join(UnifiedMountpoint, cgroupPath)
+	if !autoCreate {
+		return absPath, nil
+	}
+	// cgroup v2 中 controller 需要在父节点的 cgroup.subtree_control 中开启后，子节点才会出现对应的控制文件
+	if err := os.MkdirAll(absPath, 0755); err != nil {
+		return absPath, err
+	}
+	return absPath, enableControllers(cgroupPath)
+}
+
+// enableControllers 从根节点开始，逐级在父节点的 cgroup.subtree_control 中开启 controller
+// 相当于 echo "+cpu +cpuset +memory" > /sys/fs/cgroup/xxx/cgroup.subtree_control
+func enableControllers(cgroupPath string) error {
+	parent := UnifiedMountpoint
+	for _, elem := range strings.Split(strings.Trim(path.Clean(cgroupPath), "/"), "/") {
+		if err := enableSubtreeControl(parent); err != nil {
+			return err
+		}
+		parent = path.Join(parent, elem)
+	}
+	return nil
+}
+
+func enableSubtreeControl(dir string) error {
+	content, err := os.ReadFile(path.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		logrus.Errorf("read %s cgroup.controllers fail, %v", dir, err)
+		return err
+	}
+	available := strings.Fields(string(content))
+
+	var controllers []string
+	for _, subsys := range Ins {
+		for _, c := range available {
+			if c == subsys.Name() {
+				controllers = append(controllers, "+"+c)
+				break
+			}
+		}
+	}
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	subtreeControl := path.Join(dir, "cgroup.subtree_control")
+	if err = os.WriteFile(subtreeControl, []byte(strings.Join(controllers, " ")), 0644); err != nil {
+		logrus.Errorf("enable controllers %v in %s fail, %v", controllers, subtreeControl, err)
+		return err
+	}
+	return nil
+}
+
+func removeCgroup(cgroupPath string) error {
+	absPath, err := getCgroupPath(cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("remove %s", absPath)
+	// cgroup 目录下都是内核维护的文件，直接 rmdir 即可
+	if err = os.Remove(absPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func setCgroup(cgroupPath, cgroupFileName, limit string) error {
+	absPath, err := getCgroupPath(cgroupPath, true)
+	if err != nil {
+		logrus.Errorf("get cgroup path %s fail, %v", cgroupPath, err)
+		return err
+	}
+
+	logrus.Infof("set cgroup %s, limit: %s", filepath.Join(absPath, cgroupFileName), limit)
+
+	if err = os.WriteFile(path.Join(absPath, cgroupFileName), []byte(limit), 0644); err != nil {
+		logrus.Errorf("set %s fail, %v", cgroupFileName, err)
+		return err
+	}
+	return nil
+}
+
+func applyCgroup(cgroupPath string, pid int) error {
+	absPath, err := getCgroupPath(cgroupPath, true)
+	if err != nil {
+		logrus.Errorf("get cgroup path %s fail, %v", cgroupPath, err)
+		return err
+	}
+
+	logrus.Infof("apply cgroup %s, pid: %d", absPath, pid)
+
+	// v2 中使用 cgroup.procs 代替 v1 的 tasks
+	if err = os.WriteFile(path.Join(absPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		logrus.Errorf("apply %d to cgroup.procs fail, %v", pid, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package cgroups
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pjimming/mydocker/cgroups/subsystems"
+)
+
+// CgroupManagerV1 基于 cgroup v1 的 CgroupManager，每个 subsystem 挂载在各自的 hierarchy 上
+type CgroupManagerV1 struct {
+	Path string
+}
+
+func newCgroupManagerV1(path string) *CgroupManagerV1 {
+	return &CgroupManagerV1{Path: path}
+}
+
+func (c *CgroupManagerV1) Apply(pid int, res *subsystems.ResourceConfig) error {
+	var errMsg []string
+	for _, subsys := range subsystems.Ins {
+		if err := subsys.Apply(c.Path, pid, res); err != nil {
+			errMsg = append(errMsg, err.Error())
+		}
+	}
+
+	if len(errMsg) > 0 {
+		return fmt.Errorf("%s", strings.Join(errMsg, ", "))
+	}
+	return nil
+}
+
+func (c *CgroupManagerV1) Set(res *subsystems.ResourceConfig) error {
+	var errMsg []string
+	for _, subsys := range subsystems.Ins {
+		if err := subsys.Set(c.Path, res); err != nil {
+			errMsg = append(errMsg, err.Error())
+		}
+	}
+
+	if len(errMsg) > 0 {
+		return fmt.Errorf("%s", strings.Join(errMsg, ", "))
+	}
+	return nil
+}
+
+func (c *CgroupManagerV1) Destroy() error {
+	var errMsg []string
+	for _, subsys := range subsystems.Ins {
+		if err := subsys.Remove(c.Path); err != nil {
+			errMsg = append(errMsg, err.Error())
+		}
+	}
+
+	if len(errMsg) > 0 {
+		return fmt.Errorf("%s", strings.Join(errMsg, ", "))
+	}
+	return nil
+}
+
+func (c *CgroupManagerV1) OOMKilled() (bool, error) {
+	count, err := (&subsystems.MemorySubsystem{}).OOMKillCount(c.Path)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,68 @@
+package cgroups
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pjimming/mydocker/cgroups/fs2"
+	"github.com/pjimming/mydocker/cgroups/subsystems"
+)
+
+// CgroupManagerV2 基于 cgroup v2 的 CgroupManager，所有 controller 共用 /sys/fs/cgroup 下的同一个目录
+type CgroupManagerV2 struct {
+	Path string
+}
+
+func newCgroupManagerV2(path string) *CgroupManagerV2 {
+	return &CgroupManagerV2{Path: path}
+}
+
+func (c *CgroupManagerV2) Apply(pid int, res *subsystems.ResourceConfig) error {
+	var errMsg []string
+	for _, subsys := range fs2.Ins {
+		if err := subsys.Apply(c.Path, pid, res); err != nil {
+			errMsg = append(errMsg, err.Error())
+		}
+	}
+
+	if len(errMsg) > 0 {
+		return fmt.Errorf("%s", strings.Join(errMsg, ", "))
+	}
+	return nil
+}
+
+func (c *CgroupManagerV2) Set(res *subsystems.ResourceConfig) error {
+	var errMsg []string
+	for _, subsys := range fs2.Ins {
+		if err := subsys.Set(c.Path, res); err != nil {
+			errMsg = append(errMsg, err.Error())
+		}
+	}
+
+	if len(errMsg) > 0 {
+		return fmt.Errorf("%s", strings.Join(errMsg, ", "))
+	}
+	return nil
+}
+
+func (c *CgroupManagerV2) Destroy() error {
+	var errMsg []string
+	for _, subsys := range fs2.Ins {
+		if err := subsys.Remove(c.Path); err != nil {
+			errMsg = append(errMsg, err.Error())
+		}
+	}
+
+	if len(errMsg) > 0 {
+		return fmt.Errorf("%s", strings.Join(errMsg, ", "))
+	}
+	return nil
+}
+
+func (c *CgroupManagerV2) OOMKilled() (bool, error) {
+	count, err := (&fs2.MemorySubsystem{}).OOMKillCount(c.Path)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -1,6 +1,16 @@
 package subsystems
 
-const cpuSubsystem = "cpu"
+import (
+	"strconv"
+)
+
+const (
+	cpuSubsystem = "cpu"
+	// PeriodDefault cfs 调度周期的默认值，单位为微秒
+	PeriodDefault = 100000
+	// Percent CpuCfsQuota 的单位
+	Percent = 100
+)
 
 type CpuSubsystem struct {
 }
@@ -10,15 +20,27 @@ func (s *CpuSubsystem) CgroupFileName() string {
 }
 
 func (s *CpuSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
-	if res.CpuShare == "" {
-		return nil
+	if res.CpuShare != "" {
+		if err := setCgroup(s.Name(), cgroupPath, s.CgroupFileName(), res.CpuShare); err != nil {
+			return err
+		}
 	}
 
-	return setCgroup(s.Name(), cgroupPath, s.CgroupFileName(), res.CpuShare)
+	if res.CpuCfsQuota > 0 {
+		// cpu.cfs_period_us 与 cpu.cfs_quota_us 一起限制 CPU 使用率，例如 -cpu 50 即每个周期最多使用 50ms
+		if err := setCgroup(s.Name(), cgroupPath, "cpu.cfs_period_us", strconv.Itoa(PeriodDefault)); err != nil {
+			return err
+		}
+		quota := strconv.Itoa(PeriodDefault / Percent * res.CpuCfsQuota)
+		if err := setCgroup(s.Name(), cgroupPath, "cpu.cfs_quota_us", quota); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *CpuSubsystem) Apply(cgroupPath string, pid int, res *ResourceConfig) error {
-	if res.CpuShare == "" {
+	if res.CpuShare == "" && res.CpuCfsQuota <= 0 {
 		return nil
 	}
 
@@ -1,5 +1,10 @@
 package subsystems
 
+import (
+	"os"
+	"path"
+)
+
 const memorySubsystem = "memory"
 
 type MemorySubsystem struct {
@@ -32,3 +37,17 @@ func (s *MemorySubsystem) Apply(cgroupPath string, pid int, res *ResourceConfig)
 func (s *MemorySubsystem) Remove(cgroupPath string) error {
 	return removeCgroup(s.Name(), cgroupPath)
 }
+
+// OOMKillCount 读取 memory.oom_control 中的 oom_kill 计数，即 cgroup 内因为内存超限被杀死的进程数
+func (s *MemorySubsystem) OOMKillCount(cgroupPath string) (uint64, error) {
+	subsystemCgroupPath, err := getCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+	content, err := os.ReadFile(path.Join(subsystemCgroupPath, "memory.oom_control"))
+	if err != nil {
+		return 0, err
+	}
+	count, _ := ParseKeyValue(string(content), "oom_kill")
+	return count, nil
+}
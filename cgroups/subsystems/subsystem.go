@@ -1,10 +1,11 @@
 package subsystems
 
-// ResourceConfig 用于传递资源限制配置的结构体，包含内存限制，CPU 时间片权重，CPU核心数
+// ResourceConfig 用于传递资源限制配置的结构体，包含内存限制，CPU 时间片权重，CPU 配额，CPU核心数
 type ResourceConfig struct {
-	MemoryLimit string
-	CpuShare    string
-	CpuSet      string
+	MemoryLimit string `json:"memoryLimit"`
+	CpuShare    string `json:"cpuShare"`
+	CpuCfsQuota int    `json:"cpuCfsQuota"` // CPU 使用率上限，单位为百分比，100 表示占满一个核心
+	CpuSet      string `json:"cpuSet"`
 }
 
 // Subsystem 接口，每个Subsystem可以实现下面的4个接口，
@@ -26,9 +26,9 @@ func getCgroupPath(subsystem string, cgroupPath string, autoCreate bool) (string
 	}
 	// 指定自动创建时才判断是否存在
 	_, err = os.Stat(absPath)
-	// 只有不存在才创建
+	// 只有不存在才创建，cgroupPath 可能是 mydocker/{containerId} 这样的多级目录
 	if err != nil && os.IsNotExist(err) {
-		err = os.Mkdir(absPath, 0755)
+		err = os.MkdirAll(absPath, 0755)
 		return absPath, err
 	}
 	// 其他错误或者没有错误都直接返回
@@ -118,3 +118,19 @@ func applyCgroup(subsystem, cgroupPath string, pid int) error {
 	}
 	return nil
 }
+
+// ParseKeyValue 解析 memory.oom_control、memory.events 这类每行为 "key value" 格式的 cgroup 文件
+func ParseKeyValue(content, key string) (uint64, bool) {
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != key {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return value, true
+	}
+	return 0, false
+}
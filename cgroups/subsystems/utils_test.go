@@ -20,3 +20,15 @@ func TestFindCgroupMountPoint(t *testing.T) {
 	ast.Nil(err)
 	t.Logf("memory subsystem mount point %v", memoryMountPoint)
 }
+
+func TestParseKeyValue(t *testing.T) {
+	ast := assert.New(t)
+
+	content := "oom_kill_disable 0\nunder_oom 0\noom_kill 2\n"
+	count, ok := ParseKeyValue(content, "oom_kill")
+	ast.True(ok)
+	ast.Equal(uint64(2), count)
+
+	_, ok = ParseKeyValue(content, "max")
+	ast.False(ok)
+}
@@ -0,0 +1,29 @@
+package cgroups
+
+import (
+	"sync"
+	"syscall"
+
+	"github.com/pjimming/mydocker/cgroups/fs2"
+)
+
+// cgroup2SuperMagic cgroup2 文件系统的 magic number，定义在 linux/magic.h 中
+const cgroup2SuperMagic = 0x63677270
+
+var (
+	isUnifiedOnce sync.Once
+	isUnified     bool
+)
+
+// IsCgroup2UnifiedMode 判断宿主机是否只挂载了 cgroup v2 (unified hierarchy)
+// 通过 statfs /sys/fs/cgroup 判断文件系统类型，hybrid 模式下 /sys/fs/cgroup 是 tmpfs，仍然使用 v1
+func IsCgroup2UnifiedMode() bool {
+	isUnifiedOnce.Do(func() {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(fs2.UnifiedMountpoint, &st); err != nil {
+			return
+		}
+		isUnified = st.Type == cgroup2SuperMagic
+	})
+	return isUnified
+}
@@ -6,21 +6,73 @@ import (
 	"github.com/urfave/cli"
 
 	"github.com/pjimming/mydocker/container"
+	"github.com/pjimming/mydocker/image"
 )
 
 var CommitCommand = cli.Command{
 	Name:  "commit",
-	Usage: "Commit container to image",
+	Usage: "Commit container changes to a new image layer, mydocker commit [-a author] [-m message] [-c 'CMD [\"sh\"]'] [container] [image]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "author, a",
+			Usage: "author of the image, e.g.: -a \"pjimming <pjimming@example.com>\"",
+		},
+		cli.StringFlag{
+			Name:  "message, m",
+			Usage: "commit message",
+		},
+		cli.StringSliceFlag{
+			Name:  "change, c",
+			Usage: "apply Dockerfile instruction to the created image, supports CMD, ENTRYPOINT, ENV, WORKDIR, USER and LABEL",
+		},
+	},
 	Action: func(ctx *cli.Context) error {
-		if len(ctx.Args()) < 1 {
-			return fmt.Errorf("mssing image name")
+		if len(ctx.Args()) < 2 {
+			return fmt.Errorf("mssing container id or image name")
 		}
 		containerId := ctx.Args().Get(0)
-		imageName := ctx.Args().Get(1)
-		return commitContainer(containerId, imageName)
+		opts := &image.CommitOptions{
+			Ref:     ctx.Args().Get(1),
+			Author:  ctx.String("author"),
+			Comment: ctx.String("message"),
+		}
+		return commitContainer(containerId, opts, ctx.StringSlice("change"))
 	},
 }
 
-func commitContainer(containerId, imageName string) error {
-	return container.Commit(containerId, imageName)
+// commitContainer 只把容器 upper 目录中的改动作为新的一层，叠加在容器所用镜像的层之上生成新镜像
+// 新镜像继承容器所用镜像的默认运行参数，再应用 changes 中的指令
+func commitContainer(containerRef string, opts *image.CommitOptions, changes []string) error {
+	containerId, err := container.ResolveId(containerRef)
+	if err != nil {
+		return err
+	}
+	info, err := container.ReadInfo(containerId)
+	if err != nil {
+		return err
+	}
+	img, err := image.Get(info.ImageId)
+	if err != nil {
+		return fmt.Errorf("get image of container %s error, %v", containerId, err)
+	}
+	config := img.Config.Config
+	if err = image.ApplyChanges(&config, changes); err != nil {
+		return err
+	}
+	opts.Config = &config
+	opts.CreatedBy = info.Command
+
+	diff, err := container.ExportDiff(containerId)
+	if err != nil {
+		return err
+	}
+	imageId, err := image.Commit(img.Id, diff, opts)
+	if closeErr := diff.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("tar container %s diff error, %v", containerId, closeErr)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(imageId)
+	return nil
 }
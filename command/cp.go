@@ -0,0 +1,85 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/container"
+)
+
+var CpCommand = cli.Command{
+	Name: "cp",
+	Usage: "Copy files between a container and the host, mydocker cp [-L] [container]:src dest or mydocker cp [-L] src [container]:dest, " +
+		"use - as src or dest to stream a tar archive from STDIN or to STDOUT",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "follow-link, L",
+			Usage: "always follow symbol link in src",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) != 2 {
+			return fmt.Errorf("cp requires exactly 2 arguments")
+		}
+		return copyFiles(ctx.Args().Get(0), ctx.Args().Get(1), ctx.Bool("follow-link"))
+	},
+}
+
+// ChrootArchiveCommand 内部方法，没有暴露给外部使用
+// cp 在 chroot 到容器根目录的子进程中打包和解压，容器中的进程替换符号链接也无法读写宿主机的文件
+var ChrootArchiveCommand = cli.Command{
+	Name:  "chroot-archive",
+	Usage: "Pack or unpack files inside a chroot for cp. Do not call it outside",
+	Action: func(ctx *cli.Context) error {
+		// 标准输出是 tar 流，日志和错误都输出到标准错误
+		logrus.SetOutput(os.Stderr)
+		if err := container.RunChrootArchive(); err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	},
+}
+
+// copyFiles 在宿主机和容器之间复制文件，src 和 dst 中有且只有一个是容器中的路径
+func copyFiles(src, dst string, followLink bool) error {
+	srcContainer, srcPath := splitContainerPath(src)
+	dstContainer, dstPath := splitContainerPath(dst)
+	switch {
+	case srcContainer != "" && dstContainer != "":
+		return fmt.Errorf("copying between containers is not supported")
+	case srcContainer != "":
+		containerId, err := container.ResolveId(srcContainer)
+		if err != nil {
+			return err
+		}
+		if dstPath == "-" {
+			// tar 流写到标准输出，日志不能再输出到标准输出
+			logrus.SetOutput(os.Stderr)
+		}
+		return container.CopyFrom(containerId, srcPath, dstPath, followLink, os.Stdout)
+	case dstContainer != "":
+		containerId, err := container.ResolveId(dstContainer)
+		if err != nil {
+			return err
+		}
+		return container.CopyTo(containerId, srcPath, dstPath, followLink, os.Stdin)
+	default:
+		return fmt.Errorf("must specify at least one container source")
+	}
+}
+
+// splitContainerPath 拆分 container:path 形式的参数，以 / 或 . 开头的是宿主机上的路径
+func splitContainerPath(arg string) (string, string) {
+	if strings.HasPrefix(arg, "/") || strings.HasPrefix(arg, ".") {
+		return "", arg
+	}
+	containerRef, p, ok := strings.Cut(arg, ":")
+	if !ok || strings.Contains(containerRef, "/") {
+		return "", arg
+	}
+	return containerRef, p
+}
@@ -0,0 +1,36 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/container"
+)
+
+var DiffCommand = cli.Command{
+	Name:  "diff",
+	Usage: "Inspect changes to files or directories on a container's filesystem, A: added, C: changed, D: deleted, mydocker diff [container]",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) != 1 {
+			return fmt.Errorf("diff requires exactly 1 argument")
+		}
+		return diffContainer(ctx.Args().Get(0))
+	},
+}
+
+// diffContainer 输出容器的文件系统相对于镜像的改动
+func diffContainer(containerRef string) error {
+	containerId, err := container.ResolveId(containerRef)
+	if err != nil {
+		return err
+	}
+	changes, err := container.Diff(containerId)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	return nil
+}
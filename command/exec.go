@@ -29,6 +29,10 @@ var ExecCommand = cli.Command{
 	},
 }
 
-func execContainer(containerId string, cmdArray []string) error {
+func execContainer(containerRef string, cmdArray []string) error {
+	containerId, err := container.ResolveId(containerRef)
+	if err != nil {
+		return err
+	}
 	return container.Exec(containerId, cmdArray)
 }
@@ -0,0 +1,68 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+	"golang.org/x/sys/unix"
+
+	"github.com/pjimming/mydocker/container"
+)
+
+var ExportCommand = cli.Command{
+	Name:  "export",
+	Usage: "export a container's filesystem as a tar archive, mydocker export [-o file] [container]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "output, o",
+			Usage: "write to a file, instead of STDOUT",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) != 1 {
+			return fmt.Errorf("export requires exactly 1 argument")
+		}
+		return exportContainer(ctx.Args().Get(0), ctx.String("output"))
+	},
+}
+
+// exportContainer 把容器的 rootfs 打包写到文件或者标准输出
+func exportContainer(containerRef, output string) error {
+	containerId, err := container.ResolveId(containerRef)
+	if err != nil {
+		return err
+	}
+	var writer io.Writer = os.Stdout
+	if output == "" {
+		// 与 docker 一致，不把二进制内容输出到终端
+		if _, err = unix.IoctlGetTermios(int(os.Stdout.Fd()), unix.TCGETS); err == nil {
+			return fmt.Errorf("refusing to write tar archive to a terminal, use -o or redirect the output")
+		}
+		// tar 流写到标准输出，日志不能再输出到标准输出
+		logrus.SetOutput(os.Stderr)
+	} else {
+		file, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		writer = file
+	}
+
+	rootfs, err := container.Export(containerId)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rootfs.Close()
+	}()
+	if _, err = io.Copy(writer, rootfs); err != nil {
+		return fmt.Errorf("export container %s error, %v", containerId, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/pjimming/mydocker/container"
+	"github.com/pjimming/mydocker/image"
+)
+
+// acquireImage 找到容器使用的镜像并记录引用，容器直接使用镜像各层的目录作为 overlay 的 lowerdir
+// 同时用镜像配置补全容器的启动命令、环境变量、工作目录和用户
+func acquireImage(info *container.Info) error {
+	img, err := image.Lookup(info.Image)
+	if err != nil {
+		return err
+	}
+	config := img.Config.Config
+	args := config.Command(info.Entrypoint, info.Args)
+	if len(args) == 0 {
+		return fmt.Errorf("no command specified for image %s", info.Image)
+	}
+	if err = image.Acquire(img.Id, info.Id); err != nil {
+		return err
+	}
+	info.ImageId = img.Id
+	info.LowerDirs = img.LowerDirs()
+	info.Args = args
+	info.Env = image.MergeEnv(config.Env, info.Env)
+	if info.WorkingDir == "" {
+		info.WorkingDir = config.WorkingDir
+	}
+	if info.WorkingDir == "" {
+		info.WorkingDir = "/"
+	}
+	if info.User == "" {
+		info.User = config.User
+	}
+	return nil
+}
+
+// releaseImage 删除容器对镜像的引用
+func releaseImage(info *container.Info) {
+	if info.ImageId == "" {
+		return
+	}
+	if err := image.Release(info.ImageId, info.Id); err != nil {
+		logrus.Errorf("release image %s fail, %v", info.ImageId, err)
+	}
+}
+
+// releaseResources 容器删除后释放容器对镜像和数据卷的引用，removeVolumes 为 true 时同时删除匿名数据卷
+func releaseResources(info *container.Info, removeVolumes bool) {
+	releaseImage(info)
+	releaseVolumes(info.Volumes, info.Id, removeVolumes)
+}
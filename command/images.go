@@ -0,0 +1,125 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/image"
+	"github.com/pjimming/mydocker/utils/stringx"
+	"github.com/pjimming/mydocker/utils/timex"
+)
+
+// shortImageIdLen 镜像Id默认显示的长度
+const shortImageIdLen = 12
+
+var ImagesCommand = cli.Command{
+	Name:  "images",
+	Usage: "list images, mydocker images [-q] [--no-trunc]",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "quiet, q",
+			Usage: "only show image IDs",
+		},
+		cli.BoolFlag{
+			Name:  "no-trunc",
+			Usage: "don't truncate output",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		return listImages(ctx.Bool("quiet"), ctx.Bool("no-trunc"))
+	},
+}
+
+// imageRow images 输出的一行，一个镜像有多个镜像名时每个镜像名一行
+type imageRow struct {
+	repository string
+	tag        string
+	img        *image.Image
+	created    time.Time
+}
+
+// listImages 从镜像存储的索引中读取所有镜像，按照创建时间从新到旧打印
+func listImages(quiet, noTrunc bool) error {
+	imageIds, err := image.List()
+	if err != nil {
+		return err
+	}
+
+	var rows []imageRow
+	for _, imageId := range imageIds {
+		img, err := image.Get(imageId)
+		if err != nil {
+			logrus.Errorf("[listImages] read image %s fail, %v", imageId, err)
+			continue
+		}
+		refs, err := image.References(imageId)
+		if err != nil {
+			return err
+		}
+		created, _ := time.Parse(time.RFC3339Nano, img.Config.Created)
+		if len(refs) == 0 {
+			rows = append(rows, imageRow{repository: "<none>", tag: "<none>", img: img, created: created})
+		}
+		for _, ref := range refs {
+			i := strings.LastIndex(ref, ":")
+			rows = append(rows, imageRow{repository: ref[:i], tag: ref[i+1:], img: img, created: created})
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		return rows[i].created.After(rows[j].created)
+	})
+
+	if quiet {
+		printed := make(map[string]bool)
+		for _, row := range rows {
+			if !printed[row.img.Id] {
+				printed[row.img.Id] = true
+				fmt.Println(formatImageId(row.img.Id, noTrunc))
+			}
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	if _, err = fmt.Fprint(w, "REPOSITORY\tTAG\tIMAGE ID\tCREATED\tSIZE\n"); err != nil {
+		logrus.Errorf("[listImages] Fprint fail, %v", err)
+	}
+	for _, row := range rows {
+		created := "N/A"
+		if !row.created.IsZero() {
+			created = timex.HumanDuration(time.Since(row.created)) + " ago"
+		}
+		if _, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			row.repository,
+			row.tag,
+			formatImageId(row.img.Id, noTrunc),
+			created,
+			stringx.HumanSize(row.img.Size),
+		); err != nil {
+			logrus.Errorf("[listImages] Fprint fail, %v", err)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		logrus.Errorf("[listImages] tabwriter flush error, %v", err)
+	}
+	return nil
+}
+
+// formatImageId 默认只显示镜像Id摘要的前 12 位
+func formatImageId(imageId string, noTrunc bool) string {
+	if noTrunc {
+		return imageId
+	}
+	hexPart := strings.TrimPrefix(imageId, "sha256:")
+	if len(hexPart) > shortImageIdLen {
+		return hexPart[:shortImageIdLen]
+	}
+	return hexPart
+}
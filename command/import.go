@@ -0,0 +1,62 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/image"
+)
+
+var ImportCommand = cli.Command{
+	Name:  "import",
+	Usage: "import a tarball to create a single-layer image, mydocker import [-c 'CMD [\"sh\"]'] [-m message] file|- [image]",
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{
+			Name:  "change, c",
+			Usage: "apply Dockerfile instruction to the created image, supports CMD, ENTRYPOINT, ENV, WORKDIR, USER and LABEL",
+		},
+		cli.StringFlag{
+			Name:  "message, m",
+			Usage: "set commit message for imported image",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 || len(ctx.Args()) > 2 {
+			return fmt.Errorf("import requires 1 or 2 arguments")
+		}
+		return importImage(ctx.Args().Get(0), ctx.Args().Get(1), ctx.String("message"), ctx.StringSlice("change"))
+	},
+}
+
+// importImage 从文件或者标准输入(-)读取 rootfs tar，导入为只有一层的镜像
+func importImage(source, ref, message string, changes []string) error {
+	config := new(image.ContainerConfig)
+	if err := image.ApplyChanges(config, changes); err != nil {
+		return err
+	}
+	if message == "" {
+		message = "Imported from " + source
+	}
+
+	var reader io.Reader = os.Stdin
+	if source != "-" {
+		file, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		reader = file
+	}
+
+	imageId, err := image.Commit("", reader, &image.CommitOptions{Ref: ref, Comment: message, Config: config})
+	if err != nil {
+		return err
+	}
+	fmt.Println(imageId)
+	return nil
+}
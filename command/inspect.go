@@ -0,0 +1,75 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/template"
+
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/container"
+)
+
+var InspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "display detailed information of containers, mydocker inspect [--format '{{.Pid}}'] [container...]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Usage: "format the output using the given Go template, e.g.: --format '{{.Pid}}'",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("missing container id")
+		}
+		return inspectContainers(ctx.Args(), ctx.String("format"))
+	},
+}
+
+// inspectContainers 打印容器的完整信息
+// 未指定 format 时以缩进的 json 数组输出，指定 format 时对每个容器执行一次 Go template
+func inspectContainers(containerRefs []string, format string) error {
+	infos := make([]*container.Info, 0, len(containerRefs))
+	for _, containerRef := range containerRefs {
+		containerId, err := container.ResolveId(containerRef)
+		if err != nil {
+			return err
+		}
+		info, err := container.ReadInfo(containerId)
+		if err != nil {
+			return err
+		}
+		infos = append(infos, info)
+	}
+
+	if format == "" {
+		content, err := json.MarshalIndent(infos, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(os.Stdout, string(content))
+		return err
+	}
+
+	tmpl, err := template.New("inspect").Funcs(template.FuncMap{
+		// 与 docker 一样支持 {{json .PortMapping}} 的写法
+		"json": func(v any) (string, error) {
+			content, err := json.Marshal(v)
+			return string(content), err
+		},
+	}).Parse(format)
+	if err != nil {
+		return fmt.Errorf("parse format %s error, %v", format, err)
+	}
+	for _, info := range infos {
+		if err = tmpl.Execute(os.Stdout, info); err != nil {
+			return fmt.Errorf("execute format %s error, %v", format, err)
+		}
+		if _, err = fmt.Fprintln(os.Stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/container"
+)
+
+var KillCommand = cli.Command{
+	Name:  "kill",
+	Usage: "send a signal to a running container, mydocker kill -s SIGHUP [container]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "s",
+			Usage: "signal to send to the container",
+			Value: "SIGKILL",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("missing container id")
+		}
+		sig, err := container.ParseSignal(ctx.String("s"))
+		if err != nil {
+			return err
+		}
+		containerId, err := container.ResolveId(ctx.Args().Get(0))
+		if err != nil {
+			return err
+		}
+		return container.Kill(containerId, sig)
+	},
+}
@@ -3,12 +3,14 @@ package command
 import (
 	"fmt"
 	"os"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 
 	"github.com/pjimming/mydocker/container"
+	"github.com/pjimming/mydocker/utils/timex"
 )
 
 var ListCommand = cli.Command{
@@ -21,39 +23,30 @@ var ListCommand = cli.Command{
 }
 
 // listContainers 获取所有容器信息，并且打印出来
-// 首先遍历存放容器数据的/var/lib/mydocker/containers/目录，里面每一个子目录都是一个容器。
-// 然后使用 getContainerInfo 方法解析子目录中的 config.json 文件拿到容器信息
+// 首先遍历存放容器数据的/var/run/mydocker/目录，里面每一个子目录都是一个容器。
+// 然后使用 container.ListInfos 方法解析子目录中的 config.json 文件拿到容器信息
 // 最后格式化成 table 形式打印出来即可
 func listContainers() {
-	dirs, err := os.ReadDir(container.InfoLoc)
+	containers, err := container.ListInfos()
 	if err != nil {
-		logrus.Errorf("[listContainers] read dir fail, %v", err)
+		logrus.Errorf("[listContainers] list containers fail, %v", err)
 		return
 	}
 
-	containers := make([]*container.Info, 0)
-	for _, dir := range dirs {
-		containerInfo, err := container.ReadInfo(dir.Name())
-		if err != nil {
-			logrus.Errorf("[listContainers] read %s info fail, %v", dir.Name(), err)
-			continue
-		}
-		containers = append(containers, containerInfo)
-	}
-
 	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
-	if _, err = fmt.Fprint(w, "ID\tNAME\tPID\tSTATUS\tCOMMAND\tCREATED\n"); err != nil {
+	if _, err = fmt.Fprint(w, "ID\tNAME\tPID\tSTATUS\tCOMMAND\tCREATED\tPORTS\n"); err != nil {
 		logrus.Errorf("[listContainers] Fprint fail, %v", err)
 	}
 
 	for _, item := range containers {
-		if _, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+		if _, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
 			item.Id,
 			item.Name,
 			item.Pid,
-			item.Status,
+			formatStatus(item),
 			item.Command,
 			item.CreatedTime,
+			strings.Join(item.PortMapping, ","),
 		); err != nil {
 			logrus.Errorf("[listContainers] Fprint fail %v", err)
 		}
@@ -62,3 +55,20 @@ func listContainers() {
 		logrus.Errorf("[listContainers] tabwriter flush error, %v", err)
 	}
 }
+
+// formatStatus 把容器状态格式化为 Up 3 minutes、Exited (1) 3 minutes ago 这样的形式
+func formatStatus(info *container.Info) string {
+	switch info.Status {
+	case container.CREATED:
+		return "Created"
+	case container.RUNNING:
+		if d, err := timex.Since(info.StartedTime); err == nil {
+			return "Up " + timex.HumanDuration(d)
+		}
+	case container.Exit, container.STOP:
+		if d, err := timex.Since(info.FinishedTime); err == nil {
+			return fmt.Sprintf("Exited (%d) %s ago", info.ExitCode, timex.HumanDuration(d))
+		}
+	}
+	return info.Status
+}
@@ -0,0 +1,55 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/image"
+)
+
+var LoadCommand = cli.Command{
+	Name:  "load",
+	Usage: "load an image from a docker save or OCI layout tar archive, mydocker load -i image.tar",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "input, i",
+			Usage: "read from tar archive file, instead of STDIN",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		return loadImage(ctx.String("input"))
+	},
+}
+
+// loadImage 从文件或者标准输入导入镜像
+func loadImage(input string) error {
+	var reader io.Reader = os.Stdin
+	if input != "" {
+		file, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+		reader = file
+	}
+
+	loaded, err := image.Load(reader)
+	if err != nil {
+		return err
+	}
+	for _, item := range loaded {
+		if len(item.Refs) == 0 {
+			fmt.Printf("Loaded image ID: %s\n", item.Id)
+			continue
+		}
+		for _, ref := range item.Refs {
+			fmt.Printf("Loaded image: %s\n", ref)
+		}
+	}
+	return nil
+}
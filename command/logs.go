@@ -2,24 +2,84 @@ package command
 
 import (
 	"fmt"
-
-	"github.com/pjimming/mydocker/container"
+	"strconv"
+	"time"
 
 	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/container"
 )
 
 var LogCommand = cli.Command{
 	Name:  "logs",
-	Usage: "print logs of a container",
+	Usage: "print logs of a container, mydocker logs [-f] [--tail N] [--since 10m] [-t] [container]",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "follow, f",
+			Usage: "follow log output",
+		},
+		cli.StringFlag{
+			Name:  "tail",
+			Value: "all",
+			Usage: "number of lines to show from the end of the logs",
+		},
+		cli.StringFlag{
+			Name:  "since",
+			Usage: "show logs since timestamp (e.g. 2013-01-02T13:23:37Z) or relative (e.g. 42m for 42 minutes)",
+		},
+		cli.BoolFlag{
+			Name:  "timestamps, t",
+			Usage: "show timestamps",
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		if len(ctx.Args()) < 1 {
 			return fmt.Errorf("please input your container id")
 		}
-		containerId := ctx.Args().Get(0)
-		return logContainer(containerId)
+		opts := &container.LogOptions{
+			Follow:     ctx.Bool("follow"),
+			Tail:       -1,
+			Timestamps: ctx.Bool("timestamps"),
+		}
+		if tail := ctx.String("tail"); tail != "all" {
+			n, err := strconv.Atoi(tail)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid tail %s", tail)
+			}
+			opts.Tail = n
+		}
+		if since := ctx.String("since"); since != "" {
+			t, err := parseSince(since)
+			if err != nil {
+				return err
+			}
+			opts.Since = t
+		}
+		return logContainer(ctx.Args().Get(0), opts)
 	},
 }
 
-func logContainer(containerId string) error {
-	return container.Log(containerId)
+func logContainer(containerRef string, opts *container.LogOptions) error {
+	containerId, err := container.ResolveId(containerRef)
+	if err != nil {
+		return err
+	}
+	return container.Log(containerId, opts)
+}
+
+// parseSince 解析 --since 参数，支持 RFC3339 时间、unix 时间戳和 10m 这样的相对时间
+func parseSince(since string) (time.Time, error) {
+	if d, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, since); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateTime, since, time.Local); err == nil {
+		return t, nil
+	}
+	if sec, err := strconv.ParseInt(since, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid since %s", since)
 }
@@ -0,0 +1,135 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/container"
+)
+
+const (
+	monitorRequestFdIndex = 3
+	monitorStatusFdIndex  = 4
+)
+
+// monitorRequest run 命令通过管道发送给 monitor 进程的容器配置
+type monitorRequest struct {
+	Info         *container.Info `json:"info"`
+	CgroupParent string          `json:"cgroupParent"`
+}
+
+// monitorStatus monitor 进程启动容器后返回给 run 命令的结果
+type monitorStatus struct {
+	Id    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// MonitorCommand 内部方法，没有暴露给外部使用
+// 后台运行的容器由 monitor 进程启动，monitor 脱离 run 命令所在的会话一直运行，
+// 作为容器init进程的父进程等待容器退出，记录退出码、退出时间，并回收网络资源
+var MonitorCommand = cli.Command{
+	Name:  "monitor",
+	Usage: "Monitor a detached container until it exits. Do not call it outside",
+	Action: func(ctx *cli.Context) error {
+		return runMonitor()
+	},
+}
+
+func runMonitor() error {
+	// 继承来的文件描述符没有 close-on-exec 标记，需要手动设置，
+	// 否则容器进程也会持有 statusPipe，run 命令要等到容器退出才能读到 EOF
+	syscall.CloseOnExec(monitorRequestFdIndex)
+	syscall.CloseOnExec(monitorStatusFdIndex)
+	requestPipe := os.NewFile(uintptr(monitorRequestFdIndex), "request")
+	statusPipe := os.NewFile(uintptr(monitorStatusFdIndex), "status")
+
+	req := new(monitorRequest)
+	content, err := io.ReadAll(requestPipe)
+	_ = requestPipe.Close()
+	if err == nil {
+		err = json.Unmarshal(content, req)
+	}
+	if err != nil {
+		reportMonitorStatus(statusPipe, "", err)
+		return err
+	}
+
+	parent, cgroupManager, err := startContainer(false, req.Info, req.CgroupParent)
+	if err != nil {
+		reportMonitorStatus(statusPipe, req.Info.Id, err)
+		return err
+	}
+	// 持有 monitor 锁直到进程退出，restart 等命令据此等待退出状态记录完成
+	if _, err = container.AcquireMonitorLock(req.Info.Id); err != nil {
+		logrus.Errorf("acquire monitor lock fail, %v", err)
+	}
+	reportMonitorStatus(statusPipe, req.Info.Id, nil)
+	waitContainer(parent, req.Info, cgroupManager)
+	return nil
+}
+
+func reportMonitorStatus(statusPipe *os.File, containerId string, err error) {
+	status := &monitorStatus{Id: containerId}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	content, _ := json.Marshal(status)
+	_, _ = statusPipe.Write(content)
+	_ = statusPipe.Close()
+}
+
+// runDetached 启动 monitor 进程，由它在后台启动新容器或者已经停止的容器，容器启动成功后打印容器Id并返回
+func runDetached(info *container.Info, cgroupParent string) error {
+	requestRead, requestWrite, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	statusRead, statusWrite, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("/proc/self/exe", "monitor")
+	// 使用新的会话，终端关闭时 monitor 不会收到 SIGHUP
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.ExtraFiles = []*os.File{requestRead, statusWrite}
+	if err = cmd.Start(); err != nil {
+		logrus.Errorf("start monitor fail, %v", err)
+		return err
+	}
+	_ = requestRead.Close()
+	_ = statusWrite.Close()
+
+	content, err := json.Marshal(&monitorRequest{Info: info, CgroupParent: cgroupParent})
+	if err != nil {
+		return err
+	}
+	_, err = requestWrite.Write(content)
+	_ = requestWrite.Close()
+	if err != nil {
+		return err
+	}
+
+	content, err = io.ReadAll(statusRead)
+	_ = statusRead.Close()
+	if err != nil {
+		return err
+	}
+	status := new(monitorStatus)
+	if err = json.Unmarshal(content, status); err != nil {
+		return fmt.Errorf("monitor exited unexpectedly, %v", err)
+	}
+	if status.Error != "" {
+		return fmt.Errorf("%s", status.Error)
+	}
+	_ = cmd.Process.Release()
+	fmt.Println(status.Id)
+	return nil
+}
@@ -2,9 +2,11 @@ package command
 
 import (
 	"fmt"
+	"strconv"
 
 	"github.com/urfave/cli"
 
+	"github.com/pjimming/mydocker/container"
 	"github.com/pjimming/mydocker/network"
 )
 
@@ -69,3 +71,31 @@ var NetworkCommand = cli.Command{
 		},
 	},
 }
+
+// connectNetwork 将容器连接到指定网络，返回分配给容器的IP
+func connectNetwork(networkName, containerId string, pid int, portMapping []string) (string, error) {
+	if err := network.Init(); err != nil {
+		return "", err
+	}
+	containerInfo := &container.Info{
+		Id:          containerId,
+		Pid:         strconv.Itoa(pid),
+		PortMapping: portMapping,
+	}
+	ip, err := network.Connect(networkName, containerInfo)
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), nil
+}
+
+// disconnectNetwork 断开容器与网络的连接，回收容器占用的网络资源
+func disconnectNetwork(networkName, containerId string) error {
+	if networkName == "" {
+		return nil
+	}
+	if err := network.Init(); err != nil {
+		return err
+	}
+	return network.Disconnect(networkName, &container.Info{Id: containerId})
+}
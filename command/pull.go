@@ -0,0 +1,31 @@
+package command
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/image"
+)
+
+var PullCommand = cli.Command{
+	Name:  "pull",
+	Usage: "pull an image from a registry, mydocker pull [registry/]repo[:tag|@digest]",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) != 1 {
+			return fmt.Errorf("pull requires exactly 1 argument")
+		}
+		return pullImage(ctx.Args().Get(0))
+	},
+}
+
+// pullImage 从 registry 拉取镜像到镜像存储
+func pullImage(ref string) error {
+	imageId, err := image.Pull(ref, os.Stdout)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Status: Downloaded image %s for %s\n", imageId, ref)
+	return nil
+}
@@ -3,23 +3,49 @@ package command
 import (
 	"fmt"
 
-	"github.com/pjimming/mydocker/container"
-
+	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/container"
 )
 
 var RemoveCommand = cli.Command{
 	Name:  "rm",
-	Usage: "remove a stopped container",
+	Usage: "remove a stopped container, mydocker rm [-v] [container]",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "v",
+			Usage: "remove anonymous volumes associated with the container",
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		if len(ctx.Args()) < 1 {
 			return fmt.Errorf("missing container id")
 		}
-		containerId := ctx.Args().Get(0)
-		return removeContainer(containerId)
+		return removeContainer(ctx.Args().Get(0), ctx.Bool("v"))
 	},
 }
 
-func removeContainer(containerId string) error {
-	return container.Remove(containerId)
+// removeContainer 删除已经停止的容器，回收网络并删除容器对镜像和数据卷的引用
+// removeVolumes 为 true 时同时删除容器的匿名数据卷
+func removeContainer(containerRef string, removeVolumes bool) error {
+	containerId, err := container.ResolveId(containerRef)
+	if err != nil {
+		return err
+	}
+	info, err := container.ReadInfo(containerId)
+	if err != nil {
+		return err
+	}
+	if info.Status != container.STOP && info.Status != container.Exit {
+		return fmt.Errorf("container %s is %s, stop it before removing", containerId, info.Status)
+	}
+	if err = disconnectNetwork(info.NetworkName, containerId); err != nil {
+		logrus.Errorf("disconnect network %s fail, %v", info.NetworkName, err)
+	}
+	if err = container.Remove(containerId); err != nil {
+		return err
+	}
+	releaseResources(info, removeVolumes)
+	return nil
 }
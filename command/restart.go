@@ -0,0 +1,46 @@
+package command
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/container"
+)
+
+// restartWaitTimeout restart 等待容器退出的时间
+const restartWaitTimeout = 10 * time.Second
+
+var RestartCommand = cli.Command{
+	Name:  "restart",
+	Usage: "restart a container, mydocker restart [container]",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("missing container id")
+		}
+		return restartContainer(ctx.Args().Get(0))
+	},
+}
+
+// restartContainer 先停止容器，等待 monitor 记录容器退出后再重新启动
+func restartContainer(containerRef string) error {
+	containerId, err := container.ResolveId(containerRef)
+	if err != nil {
+		return err
+	}
+	info, err := container.ReadInfo(containerId)
+	if err != nil {
+		return err
+	}
+	if info.Status == container.RUNNING || info.Status == container.CREATED {
+		if err = stopContainer(containerId, syscall.SIGTERM, container.StopTimeout); err != nil {
+			return err
+		}
+	}
+	if err = container.WaitMonitorExit(containerId, restartWaitTimeout); err != nil {
+		return err
+	}
+	return startStoppedContainer(containerId)
+}
@@ -0,0 +1,52 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/image"
+)
+
+var RmiCommand = cli.Command{
+	Name:  "rmi",
+	Usage: "remove one or more images, mydocker rmi [-f] image...",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "force, f",
+			Usage: "force removal of the image, even if it is used by containers",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("missing image name or id")
+		}
+		failed := 0
+		for _, ref := range ctx.Args() {
+			if err := removeImage(ref, ctx.Bool("force")); err != nil {
+				logrus.Errorf("remove image %s fail, %v", ref, err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to remove %d of %d images", failed, len(ctx.Args()))
+		}
+		return nil
+	},
+}
+
+// removeImage 删除镜像名或者镜像，被容器使用的镜像只有 force 为 true 时才能删除
+func removeImage(ref string, force bool) error {
+	removed, err := image.Remove(ref, force)
+	if err != nil {
+		return err
+	}
+	for _, untagged := range removed.Untagged {
+		fmt.Printf("Untagged: %s\n", untagged)
+	}
+	if removed.Deleted != "" {
+		fmt.Printf("Deleted: %s\n", removed.Deleted)
+	}
+	return nil
+}
@@ -1,9 +1,14 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -11,13 +16,14 @@ import (
 	"github.com/pjimming/mydocker/cgroups"
 	"github.com/pjimming/mydocker/cgroups/subsystems"
 	"github.com/pjimming/mydocker/container"
+	"github.com/pjimming/mydocker/network"
 	"github.com/pjimming/mydocker/utils/randx"
 )
 
 var RunCommand = cli.Command{
 	Name: "run",
 	Usage: `Create a container with namespace and cgroups limit
-			mydocker run -it [command]`,
+			mydocker run -it image [command]`,
 
 	Flags: []cli.Flag{
 		cli.BoolFlag{
@@ -38,15 +44,24 @@ var RunCommand = cli.Command{
 			Name:  "cpushare",
 			Usage: "cpu quota, e.g.: -cpushare 100",
 		},
+		cli.IntFlag{
+			// 限制进程cpu使用率上限
+			Name:  "cpu",
+			Usage: "cpu percent limit, e.g.: -cpu 50",
+		},
 		cli.StringFlag{
 			// 限制进程cpu使用率
 			Name:  "cpuset",
 			Usage: "cpuset limit, e.g.: -cpuset 2,4",
 		},
-		cli.StringFlag{
+		cli.StringSliceFlag{
 			// volume
 			Name:  "v",
-			Usage: "volume, e.g.: -v /etc/conf:/etc/conf",
+			Usage: "volume, host:container[:ro|rw][,rshared|rslave|rprivate], e.g.: -v /etc/conf:/etc/conf:ro -v /data:/data",
+		},
+		cli.StringSliceFlag{
+			Name:  "tmpfs",
+			Usage: "mount a tmpfs directory, path[:options], e.g.: --tmpfs /run:size=64m,mode=1777",
 		},
 		cli.StringFlag{
 			Name:  "name",
@@ -56,16 +71,48 @@ var RunCommand = cli.Command{
 			Name:  "e",
 			Usage: "set environment",
 		},
+		cli.StringFlag{
+			Name:  "net",
+			Usage: "container network, e.g.: -net testbr",
+		},
+		cli.StringSliceFlag{
+			Name:  "p",
+			Usage: "port mapping, e.g.: -p 8080:80 -p 30336:3306",
+		},
+		cli.StringFlag{
+			Name:  "hostname",
+			Usage: "container host name, default is the container id",
+		},
+		cli.StringFlag{
+			Name:  "entrypoint",
+			Usage: "overwrite the default entrypoint of the image, e.g.: --entrypoint /bin/sh",
+		},
+		cli.StringFlag{
+			Name:  "workdir, w",
+			Usage: "working directory inside the container, default is the WorkingDir of the image",
+		},
+		cli.StringFlag{
+			Name:  "u",
+			Usage: "username or uid (format: <name|uid>[:<group|gid>]), e.g.: -u nobody",
+		},
+		cli.BoolFlag{
+			Name:  "init",
+			Usage: "run an init inside the container that forwards signals and reaps processes",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-parent",
+			Usage: "parent cgroup for the container, e.g.: --cgroup-parent mydocker",
+		},
 	},
 
 	/*
-		1. 判断参数是否包含command
-		2. 获取用户指定的command
+		1. 判断参数是否包含镜像
+		2. 获取用户指定的command，没有指定时使用镜像的 Entrypoint 和 Cmd
 		3. 调用 run function 去准备启动容器
 	*/
 	Action: func(ctx *cli.Context) error {
 		if len(ctx.Args()) < 1 {
-			return fmt.Errorf("missing container command")
+			return fmt.Errorf("missing image name")
 		}
 
 		imageName := ctx.Args().First()
@@ -79,17 +126,52 @@ var RunCommand = cli.Command{
 			return fmt.Errorf("it and d paramter can not both provided")
 		}
 
+		volumes, err := container.ParseVolumes(ctx.StringSlice("v"))
+		if err != nil {
+			return err
+		}
+		tmpfs, err := container.ParseTmpfsList(ctx.StringSlice("tmpfs"))
+		if err != nil {
+			return err
+		}
+		if err = network.ValidatePortMapping(ctx.StringSlice("p")); err != nil {
+			return err
+		}
+
 		resConf := &subsystems.ResourceConfig{
 			MemoryLimit: ctx.String("mem"),
 			CpuShare:    ctx.String("cpushare"),
+			CpuCfsQuota: ctx.Int("cpu"),
 			CpuSet:      ctx.String("cpuset"),
 		}
+		// --entrypoint "" 表示清空镜像的 Entrypoint
+		var entrypoint []string
+		if ctx.IsSet("entrypoint") {
+			entrypoint = []string{}
+			if ctx.String("entrypoint") != "" {
+				entrypoint = append(entrypoint, ctx.String("entrypoint"))
+			}
+		}
+
 		logrus.Infof("run cmd = %s", strings.Join(cmdArray, " "))
-		volume := ctx.String("v")
-		containerName := ctx.String("name")
-		environSlice := ctx.StringSlice("e")
-		run(tty, cmdArray, resConf, volume, containerName, imageName, environSlice)
-		return nil
+		containerInfo := &container.Info{
+			Name:           ctx.String("name"),
+			Entrypoint:     entrypoint,
+			Args:           cmdArray,
+			WorkingDir:     ctx.String("workdir"),
+			Hostname:       ctx.String("hostname"),
+			User:           ctx.String("u"),
+			Init:           ctx.Bool("init"),
+			Tty:            tty,
+			Image:          imageName,
+			Env:            ctx.StringSlice("e"),
+			Volumes:        volumes,
+			Tmpfs:          tmpfs,
+			ResourceConfig: resConf,
+			NetworkName:    ctx.String("net"),
+			PortMapping:    ctx.StringSlice("p"),
+		}
+		return run(tty, containerInfo, ctx.String("cgroup-parent"))
 	},
 }
 
@@ -98,51 +180,214 @@ var RunCommand = cli.Command{
 这里的Start方法是真正开始前面创建好的command的调用，它首先会clone出来一个namespace隔离的
 进程，然后在子进程中，调用/proc/self/exe,也就是调用自己，发送init参数，调用我们写的init方法，
 去初始化容器的一些资源。
+后台运行的容器交给 monitor 进程启动，由 monitor 等待容器退出并记录退出状态。
 */
-func run(tty bool, cmd []string, runResConf *subsystems.ResourceConfig, volume, containerName, imageName string, envSlice []string) {
-	containerId := randx.RandString(container.IDLength)
+func run(tty bool, info *container.Info, cgroupParent string) error {
+	if !tty {
+		return runDetached(info, cgroupParent)
+	}
 
-	parent, writePipe, err := container.NewParentProcess(tty, volume, containerId, imageName, envSlice)
+	parent, cgroupManager, err := startContainer(tty, info, cgroupParent)
 	if err != nil {
-		return
+		return err
 	}
-	if err = parent.Start(); err != nil {
-		logrus.Errorf("run fail, %v", err)
+	waitContainer(parent, info, cgroupManager)
+
+	// -it 运行的容器退出后直接清理
+	if err = container.DeleteWorkSpace(info.Volumes, info.Id); err != nil {
+		logrus.Errorf("delete work space fail, %v", err)
+	}
+	_ = container.DeleteInfo(info.Id)
+	// 自动删除的容器同时删除它的匿名数据卷
+	releaseResources(info, true)
+	if err = cgroupManager.Destroy(); err != nil {
+		logrus.Errorf("cgroup manager destroy fail, %v", err)
 	}
+	return nil
+}
 
-	// record container info
-	if err = container.RecordInfo(parent.Process.Pid, cmd, containerName, containerId, volume); err != nil {
-		logrus.Errorf("record container info fail, %v", err)
-		return
+// startContainer 创建容器进程，配置 cgroup 和网络后记录容器信息，最后发送启动参数让容器运行用户命令
+// info 中已经有容器Id时表示重新启动一个已经停止的容器，复用之前的工作目录、cgroup 路径和配置
+func startContainer(tty bool, info *container.Info, cgroupParent string) (*exec.Cmd, cgroups.CgroupManager, error) {
+	isNew := info.Id == ""
+	if isNew {
+		if err := prepareContainer(info, cgroupParent); err != nil {
+			return nil, nil, err
+		}
+	} else if err := container.MountWorkSpace(info.Volumes, info.LowerDirs, info.Id); err != nil {
+		umountWorkSpace(info)
+		return nil, nil, err
+	}
+	containerId := info.Id
+
+	parent, writePipe, err := container.NewParentProcess(tty, containerId)
+	if err == nil {
+		if err = parent.Start(); err != nil {
+			logrus.Errorf("run fail, %v", err)
+		}
 	}
+	if err != nil {
+		if isNew {
+			_ = container.DeleteWorkSpace(info.Volumes, containerId)
+			_ = container.DeleteInfo(containerId)
+			releaseResources(info, true)
+		} else {
+			umountWorkSpace(info)
+		}
+		return nil, nil, err
+	}
+	info.Pid = strconv.Itoa(parent.Process.Pid)
 
-	// new cgroup manager
-	cgroupManager := cgroups.NewCgroupManager("mydocker-cgroup")
-	if err = cgroupManager.Set(runResConf); err != nil {
+	// new cgroup manager，每个容器使用独立的 cgroup
+	cgroupManager := cgroups.NewCgroupManager(info.CgroupPath)
+	if err = cgroupManager.Set(info.ResourceConfig); err != nil {
 		logrus.Errorf("set cgroup res fail, %v", err)
 	}
-	if err = cgroupManager.Apply(parent.Process.Pid, runResConf); err != nil {
+	if err = cgroupManager.Apply(parent.Process.Pid, info.ResourceConfig); err != nil {
 		logrus.Errorf("apply %d process cgroup res fail, %v", parent.Process.Pid, err)
 	}
 
-	// 在子进程创建后才能通过匹配来发送参数
-	sendInitCommand(cmd, writePipe)
-	if tty {
+	// 启动失败时杀死容器进程并清理已经创建的资源，已经存在的容器只恢复为退出状态
+	cleanup := func() {
+		_ = parent.Process.Kill()
 		_ = parent.Wait()
-		if err = container.DeleteWorkSpace(volume, containerId); err != nil {
-			logrus.Errorf("delete work space fail, %v", err)
+		container.CloseParentProcess(parent)
+		_ = disconnectNetwork(info.NetworkName, containerId)
+		if !isNew {
+			umountWorkSpace(info)
+			_ = container.RecordExit(containerId, exitCodeOf(parent.ProcessState), false)
+			return
 		}
+		_ = container.DeleteWorkSpace(info.Volumes, containerId)
 		_ = container.DeleteInfo(containerId)
-		if err = cgroupManager.Destroy(); err != nil {
-			logrus.Errorf("cgroup manager destroy fail, %v", err)
+		releaseResources(info, true)
+		_ = cgroupManager.Destroy()
+	}
+
+	// 配置容器网络，需要在用户进程启动前完成
+	if info.NetworkName != "" {
+		if info.IP, err = connectNetwork(info.NetworkName, containerId, parent.Process.Pid, info.PortMapping); err != nil {
+			logrus.Errorf("connect network %s fail, %v", info.NetworkName, err)
+			cleanup()
+			return nil, nil, err
 		}
 	}
+
+	// record container info
+	info.Command = strings.Join(info.Args, " ")
+	if err = container.RecordInfo(info); err != nil {
+		logrus.Errorf("record container info fail, %v", err)
+		cleanup()
+		return nil, nil, err
+	}
+
+	// 在子进程创建后才能通过匹配来发送参数
+	spec := &container.InitSpec{
+		Args:     info.Args,
+		Env:      info.Env,
+		Cwd:      info.WorkingDir,
+		Hostname: info.Hostname,
+		User:     info.User,
+		Init:     info.Init,
+		Volumes:  info.Volumes,
+		Tmpfs:    info.Tmpfs,
+	}
+	if err = sendInitCommand(spec, writePipe); err != nil {
+		logrus.Errorf("send init command fail, %v", err)
+		cleanup()
+		return nil, nil, err
+	}
+	if err = container.UpdateInfo(containerId, func(info *container.Info) error {
+		info.Status = container.RUNNING
+		info.StartedTime = time.Now().Format(time.DateTime)
+		info.ExitCode = 0
+		info.OOMKilled = false
+		return nil
+	}); err != nil {
+		logrus.Errorf("update container status fail, %v", err)
+	}
+	return parent, cgroupManager, nil
 }
 
-// sendInitCommand 通过writePipe将指令发送给子进程
-func sendInitCommand(comArray []string, writePipe *os.File) {
-	command := strings.Join(comArray, " ")
-	logrus.Infof("command = %s", command)
-	_, _ = writePipe.WriteString(command)
-	_ = writePipe.Close()
+// umountWorkSpace 启动已经停止的容器失败时卸载 MountWorkSpace 挂载的 overlayFs 和 volume
+func umountWorkSpace(info *container.Info) {
+	if err := container.UmountWorkSpace(info.Volumes, info.Id); err != nil {
+		logrus.Errorf("umount work space of %s fail, %v", info.Id, err)
+	}
+}
+
+// prepareContainer 为新容器分配Id、检查容器名并创建工作目录
+func prepareContainer(info *container.Info, cgroupParent string) error {
+	// 容器名不能重复，否则无法通过容器名找到唯一的容器
+	if info.Name != "" {
+		inUse, err := container.NameInUse(info.Name)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return fmt.Errorf("container name %s is already in use", info.Name)
+		}
+	}
+	info.Id = randx.RandString(container.IDLength)
+	if info.Hostname == "" {
+		info.Hostname = info.Id
+	}
+	info.CgroupPath = container.GetCgroupPath(cgroupParent, info.Id)
+	if err := acquireImage(info); err != nil {
+		logrus.Errorf("acquire image %s error, %v", info.Image, err)
+		return err
+	}
+	if err := acquireVolumes(info.Volumes, info.Id); err != nil {
+		logrus.Errorf("acquire volumes error, %v", err)
+		releaseImage(info)
+		return err
+	}
+	if err := container.NewWorkSpace(info.Volumes, info.LowerDirs, info.Id); err != nil {
+		logrus.Errorf("new work space error, %v", err)
+		releaseResources(info, true)
+		return err
+	}
+	return nil
+}
+
+// waitContainer 等待容器init进程退出，记录退出码并回收容器的网络资源
+func waitContainer(parent *exec.Cmd, info *container.Info, cgroupManager cgroups.CgroupManager) {
+	_ = parent.Wait()
+	container.CloseParentProcess(parent)
+	exitCode := exitCodeOf(parent.ProcessState)
+	oomKilled, _ := cgroupManager.OOMKilled()
+	logrus.Infof("container %s exited, exit code: %d, oom killed: %v", info.Id, exitCode, oomKilled)
+
+	// 先回收网络再记录退出状态，restart 等到退出状态记录后才会重新连接网络
+	if err := disconnectNetwork(info.NetworkName, info.Id); err != nil {
+		logrus.Errorf("disconnect network %s fail, %v", info.NetworkName, err)
+	}
+	if err := container.RecordExit(info.Id, exitCode, oomKilled); err != nil {
+		logrus.Errorf("record container exit fail, %v", err)
+	}
+}
+
+// exitCodeOf 获取进程的退出码，被信号杀死的进程与 shell 一样使用 128+信号值
+func exitCodeOf(state *os.ProcessState) int {
+	if state == nil {
+		return -1
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+// sendInitCommand 通过writePipe将启动参数以json格式发送给子进程
+func sendInitCommand(spec *container.InitSpec, writePipe *os.File) error {
+	defer func() {
+		_ = writePipe.Close()
+	}()
+	specJson, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("init spec = %s", specJson)
+	_, err = writePipe.Write(specJson)
+	return err
 }
@@ -0,0 +1,42 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/container"
+)
+
+var StartCommand = cli.Command{
+	Name:  "start",
+	Usage: "start a stopped container, mydocker start [container]",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("missing container id")
+		}
+		return startStoppedContainer(ctx.Args().Get(0))
+	},
+}
+
+// startStoppedContainer 重新启动已经停止的容器
+// 复用容器原来的 overlayFs 工作目录(包括 upper 层的修改)、cgroup 限制、网络、启动命令和运行方式
+func startStoppedContainer(containerRef string) error {
+	containerId, err := container.ResolveId(containerRef)
+	if err != nil {
+		return err
+	}
+	info, err := container.ReadInfo(containerId)
+	if err != nil {
+		return err
+	}
+	if info.Status != container.STOP && info.Status != container.Exit {
+		return fmt.Errorf("container %s is %s, only stopped or exited container can be started", containerRef, info.Status)
+	}
+	// 上一次运行的 monitor 进程还没有退出时不能启动
+	if err = container.WaitMonitorExit(containerId, 0); err != nil {
+		return fmt.Errorf("container %s is still exiting", containerRef)
+	}
+	// 按照容器原来的运行方式启动，-it 运行的容器在前台运行并连接到当前终端
+	return run(info.Tty, info, "")
+}
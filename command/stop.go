@@ -2,22 +2,55 @@ package command
 
 import (
 	"fmt"
-	"github.com/pjimming/mydocker/container"
+	"syscall"
+	"time"
+
 	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/container"
 )
 
 var StopCommand = cli.Command{
 	Name:  "stop",
-	Usage: "stop a container",
+	Usage: "stop a container, mydocker stop -t 10 [container]",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "t",
+			Usage: "seconds to wait for stop before killing it",
+			Value: int(container.StopTimeout / time.Second),
+		},
+		cli.StringFlag{
+			Name:  "s",
+			Usage: "signal to send to the container, e.g.: -s SIGINT",
+			Value: "SIGTERM",
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		if len(ctx.Args()) < 1 {
 			return fmt.Errorf("missing container id")
 		}
-		containerId := ctx.Args().Get(0)
-		return stopContainer(containerId)
+		sig, err := container.ParseSignal(ctx.String("s"))
+		if err != nil {
+			return err
+		}
+		if ctx.Int("t") < 0 {
+			return fmt.Errorf("invalid stop timeout %d", ctx.Int("t"))
+		}
+		return stopContainer(ctx.Args().Get(0), sig, time.Duration(ctx.Int("t"))*time.Second)
 	},
 }
 
-func stopContainer(containerId string) error {
-	return container.Stop(containerId)
+func stopContainer(containerRef string, sig syscall.Signal, timeout time.Duration) error {
+	containerId, err := container.ResolveId(containerRef)
+	if err != nil {
+		return err
+	}
+	if err = container.Stop(containerId, sig, timeout); err != nil {
+		return err
+	}
+	info, err := container.ReadInfo(containerId)
+	if err != nil {
+		return err
+	}
+	return disconnectNetwork(info.NetworkName, containerId)
 }
@@ -0,0 +1,29 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/image"
+)
+
+var TagCommand = cli.Command{
+	Name:  "tag",
+	Usage: "create a tag that refers to an image, mydocker tag source_image[:tag] target_image[:tag]",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) != 2 {
+			return fmt.Errorf("tag requires exactly 2 arguments")
+		}
+		return tagImage(ctx.Args().Get(0), ctx.Args().Get(1))
+	},
+}
+
+// tagImage 为镜像添加新的镜像名，目标镜像名已经存在时指向新的镜像
+func tagImage(source, target string) error {
+	imageId, err := image.Resolve(source)
+	if err != nil {
+		return err
+	}
+	return image.Tag(target, imageId)
+}
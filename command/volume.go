@@ -0,0 +1,157 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"github.com/pjimming/mydocker/container"
+	"github.com/pjimming/mydocker/volume"
+)
+
+var VolumeCommand = cli.Command{
+	Name:  "volume",
+	Usage: "manage volumes",
+	Subcommands: []cli.Command{
+		{
+			Name:  "create",
+			Usage: "create a volume, mydocker volume create [name]",
+			Action: func(ctx *cli.Context) error {
+				v, err := volume.Create(ctx.Args().First())
+				if err != nil {
+					return err
+				}
+				fmt.Println(v.Name)
+				return nil
+			},
+		},
+		{
+			Name:  "ls",
+			Usage: "list volumes",
+			Action: func(ctx *cli.Context) error {
+				return listVolumes()
+			},
+		},
+		{
+			Name:  "inspect",
+			Usage: "display detailed information of volumes, mydocker volume inspect [name...]",
+			Action: func(ctx *cli.Context) error {
+				if len(ctx.Args()) < 1 {
+					return fmt.Errorf("missing volume name")
+				}
+				return inspectVolumes(ctx.Args())
+			},
+		},
+		{
+			Name:  "rm",
+			Usage: "remove volumes not used by any container, mydocker volume rm [name...]",
+			Action: func(ctx *cli.Context) error {
+				if len(ctx.Args()) < 1 {
+					return fmt.Errorf("missing volume name")
+				}
+				for _, name := range ctx.Args() {
+					if err := volume.Remove(name); err != nil {
+						return err
+					}
+					fmt.Println(name)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "prune",
+			Usage: "remove unused anonymous volumes",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "all, a",
+					Usage: "remove all unused volumes, not just anonymous ones",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				removed, err := volume.Prune(ctx.Bool("all"))
+				if err != nil {
+					return err
+				}
+				for _, name := range removed {
+					fmt.Println(name)
+				}
+				return nil
+			},
+		},
+	},
+}
+
+func listVolumes() error {
+	volumes, err := volume.List()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	if _, err = fmt.Fprint(w, "VOLUME NAME\tMOUNTPOINT\tIN USE\tCREATED\n"); err != nil {
+		logrus.Errorf("[listVolumes] Fprint fail, %v", err)
+	}
+	for _, v := range volumes {
+		if _, err = fmt.Fprintf(w, "%s\t%s\t%v\t%s\n", v.Name, v.Mountpoint, v.InUse(), v.CreatedAt); err != nil {
+			logrus.Errorf("[listVolumes] Fprint fail, %v", err)
+		}
+	}
+	return w.Flush()
+}
+
+func inspectVolumes(names []string) error {
+	volumes := make([]*volume.Volume, 0, len(names))
+	for _, name := range names {
+		v, err := volume.Get(name)
+		if err != nil {
+			return err
+		}
+		volumes = append(volumes, v)
+	}
+	content, err := json.MarshalIndent(volumes, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(content))
+	return err
+}
+
+// acquireVolumes 为容器创建或者找到 mydocker 管理的数据卷，记录引用后把数据卷目录作为挂载的宿主机目录
+func acquireVolumes(volumes []*container.Volume, containerId string) error {
+	for i, v := range volumes {
+		if !v.IsManaged() {
+			continue
+		}
+		created, err := volume.Create(v.Name)
+		if err == nil {
+			err = volume.Acquire(created.Name, containerId)
+		}
+		if err != nil {
+			releaseVolumes(volumes[:i], containerId, true)
+			return err
+		}
+		v.Name, v.Source = created.Name, created.Mountpoint
+	}
+	return nil
+}
+
+// releaseVolumes 删除容器对数据卷的引用，removeAnonymous 为 true 时同时删除不再被引用的匿名数据卷
+func releaseVolumes(volumes []*container.Volume, containerId string, removeAnonymous bool) {
+	for _, v := range volumes {
+		if !v.IsManaged() || v.Name == "" {
+			continue
+		}
+		if err := volume.Release(v.Name, containerId); err != nil {
+			logrus.Errorf("release volume %s fail, %v", v.Name, err)
+			continue
+		}
+		if removeAnonymous && v.Anonymous {
+			if err := volume.Remove(v.Name); err != nil {
+				logrus.Errorf("remove volume %s fail, %v", v.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/pjimming/mydocker/archive"
+)
+
+// EnvChrootArchive 传递给 chroot-archive 子进程的打包或者解压参数
+const EnvChrootArchive = "mydocker_chroot_archive"
+
+// chrootRequest chroot-archive 子进程的参数，Path 是 Root 中的路径
+/*
+容器中的进程随时可以把路径中的某一级替换成指向 / 的符号链接，在宿主机上按照路径打包或者解压时
+会读写到宿主机的文件。子进程先 chroot 到容器的根目录再打包或者解压，路径和符号链接都由内核在根目录中解析
+*/
+type chrootRequest struct {
+	Root  string                `json:"root"`
+	Path  string                `json:"path"`
+	Tar   *archive.TarOptions   `json:"tar,omitempty"`   // 打包时不为空
+	Untar *archive.UntarOptions `json:"untar,omitempty"` // 解压时不为空
+}
+
+// chrootTar 在 root 中把 p 打包写到 w
+func chrootTar(w io.Writer, root, p string, opts *archive.TarOptions) error {
+	if opts == nil {
+		opts = new(archive.TarOptions)
+	}
+	return runChrootArchive(&chrootRequest{Root: root, Path: p, Tar: opts}, nil, w)
+}
+
+// chrootUntar 在 root 中把 tar 流解压到 dir
+func chrootUntar(r io.Reader, root, dir string, opts *archive.UntarOptions) error {
+	if opts == nil {
+		opts = new(archive.UntarOptions)
+	}
+	return runChrootArchive(&chrootRequest{Root: root, Path: dir, Untar: opts}, r, io.Discard)
+}
+
+// runChrootArchive 启动 chroot-archive 子进程，tar 流通过子进程的标准输入输出传递，出错时子进程把错误写到标准错误
+func runChrootArchive(req *chrootRequest, stdin io.Reader, stdout io.Writer) error {
+	content, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	stderr := new(bytes.Buffer)
+	cmd := exec.Command("/proc/self/exe", "chroot-archive")
+	cmd.Env = append(os.Environ(), EnvChrootArchive+"="+string(content))
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err = cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%s", msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// RunChrootArchive chroot-archive 子进程的入口，chroot 到参数中的根目录后打包到标准输出或者从标准输入解压
+func RunChrootArchive() error {
+	req := new(chrootRequest)
+	if err := json.Unmarshal([]byte(os.Getenv(EnvChrootArchive)), req); err != nil {
+		return fmt.Errorf("invalid chroot archive request, %v", err)
+	}
+	if err := unix.Chroot(req.Root); err != nil {
+		return &os.PathError{Op: "chroot", Path: req.Root, Err: err}
+	}
+	if err := unix.Chdir("/"); err != nil {
+		return err
+	}
+	if req.Tar != nil {
+		return archive.WriteTar(os.Stdout, req.Path, req.Tar)
+	}
+	return archive.Untar(os.Stdin, req.Path, req.Untar)
+}
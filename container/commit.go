@@ -1,18 +1,19 @@
 package container
 
 import (
-	"os/exec"
+	"fmt"
+	"io"
+	"os"
 
-	"github.com/sirupsen/logrus"
+	"github.com/pjimming/mydocker/archive"
 )
 
-func Commit(containerId, imageName string) error {
-	mntPath := getMerged(containerId)
-	imageTar := getImage(imageName)
-	if _, err := exec.Command("tar", "-czf", imageTar, "-C", mntPath, ".").CombinedOutput(); err != nil {
-		logrus.Errorf("tar folder %s fail, %v", mntPath, err)
-		return err
+// ExportDiff 把容器 overlay upper 目录中的改动打包成 OCI 格式的层，用于提交镜像
+// overlay 的 whiteout 和不透明目录转换为 .wh. 文件，停止的容器也可以导出
+func ExportDiff(containerId string) (io.ReadCloser, error) {
+	upperDir := getUpper(containerId)
+	if _, err := os.Stat(upperDir); err != nil {
+		return nil, fmt.Errorf("container %s upper dir error, %v", containerId, err)
 	}
-	logrus.Infof("commit %s container success, image: %s", containerId, imageTar)
-	return nil
+	return archive.Tar(upperDir, &archive.TarOptions{OverlayWhiteouts: true}), nil
 }
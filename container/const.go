@@ -1,14 +1,29 @@
 package container
 
+import "time"
+
+// 容器的状态，created -> running -> exited/stopped
+const (
+	CREATED = "created"
+	RUNNING = "running"
+	STOP    = "stopped"
+	Exit    = "exited"
+)
+
 const (
-	RUNNING       = "running"
-	STOP          = "stopped"
-	Exit          = "exited"
 	InfoLoc       = "/var/run/mydocker/"
 	InfoLocFormat = InfoLoc + "%s/"
 	ConfigName    = "config.json"
 	IDLength      = 10
 	LogFile       = "container.log"
+	// monitorLockName monitor 进程持有的文件锁
+	monitorLockName = "monitor.lock"
+	// CgroupParent 容器 cgroup 的默认父目录，每个容器使用 mydocker/{containerId} 作为自己的 cgroup
+	CgroupParent = "mydocker"
+	// StopTimeout stop 等待容器退出的默认时间，超时后发送 SIGKILL
+	StopTimeout = 10 * time.Second
+	// killWaitTimeout 发送 SIGKILL 后等待容器退出的时间
+	killWaitTimeout = 5 * time.Second
 )
 
 // nsenter里的C代码里已经出现mydocker_pid和mydocker_cmd这两个Key,主要是为了控制是否执行C代码里面的setns.
@@ -20,7 +35,6 @@ const (
 // 容器相关目录
 const (
 	RootUrl         = "/root/"
-	lowerDirFormat  = "/root/%s/lower"
 	upperDirFormat  = "/root/%s/upper"
 	workDirFormat   = "/root/%s/work"
 	mergedDirFormat = "/root/%s/merged"
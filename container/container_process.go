@@ -17,7 +17,7 @@ import (
 3.下面的clone参数就是去fork出来一个新进程，并且使用了namespace隔离新创建的进程和外部环境。
 4.如果用户指定了-it参数，就需要把当前进程的输入输出导入到标准输入输出上
 */
-func NewParentProcess(tty bool, volume, containerId, imageName string, envSlice []string) (*exec.Cmd, *os.File, error) {
+func NewParentProcess(tty bool, containerId string) (*exec.Cmd, *os.File, error) {
 	// 创建匿名管道用于传递参数，将readPipe作为子进程的ExtraFiles，子进程从readPipe中读取参数
 	// 父进程中则通过writePipe将参数写入管道
 	readPipe, writePipe, err := os.Pipe()
@@ -43,22 +43,34 @@ func NewParentProcess(tty bool, volume, containerId, imageName string, envSlice
 			logrus.Errorf("[NewParentProcess] mkdir %s all fail, %v", containerDir, err)
 			return nil, nil, err
 		}
+		// 后台运行的容器把标准输出和标准错误以 json-file 格式记录到 container.log 中
+		// Stdout、Stderr 不是文件时 exec.Cmd 会创建管道并负责拷贝，Wait 会等待拷贝结束
 		stdLogFilePath := path.Join(containerDir, LogFile)
-		stdLogFile, err := os.Create(stdLogFilePath)
+		logger, err := newJsonLogger(stdLogFilePath, LogMaxSize, LogMaxFiles)
 		if err != nil {
 			logrus.Errorf("[NewParentProcess] create %s error, %v", stdLogFilePath, err)
 			return nil, nil, err
 		}
-		cmd.Stdout = stdLogFile
+		cmd.Stdout = logger.Stream(StreamStdout)
+		cmd.Stderr = logger.Stream(StreamStderr)
 	}
 
 	cmd.ExtraFiles = []*os.File{readPipe}
+	// 容器的工作目录需要在调用前通过 NewWorkSpace 或 MountWorkSpace 准备好
 	cmd.Dir = getMerged(containerId)
-	cmd.Env = append(os.Environ(), envSlice...)
-	if err = NewWorkSpace(volume, imageName, containerId); err != nil {
-		logrus.Errorf("[NewParentProcess] new work space error, %v", err)
-		return nil, nil, err
-	}
 
 	return cmd, writePipe, nil
 }
+
+// CloseParentProcess 容器进程退出后，写入缓存的最后一行日志并关闭日志文件
+func CloseParentProcess(cmd *exec.Cmd) {
+	stdout, ok := cmd.Stdout.(*logStream)
+	if !ok {
+		return
+	}
+	_ = stdout.Close()
+	if stderr, ok := cmd.Stderr.(*logStream); ok {
+		_ = stderr.Close()
+	}
+	_ = stdout.logger.Close()
+}
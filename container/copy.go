@@ -0,0 +1,473 @@
+package container
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/pjimming/mydocker/archive"
+)
+
+// maxSymlinks 解析路径时最多跟随的符号链接数量，与内核的限制一致
+const maxSymlinks = 40
+
+// containerFs 容器文件系统的视图，路径都是容器中的绝对路径
+/*
+1）运行中的容器直接读写 merged 目录，宿主机重启后状态还是运行中但 merged 没有挂载的容器按照停止的容器处理
+2）停止的容器把 upper 和镜像的层一起作为 lower 只读挂载成视图，并把 volume 绑定挂载到视图中，
+   读取和解析路径都在视图中进行，写入时先卸载容器的 overlayFs 和视图，再写到 upper 目录，
+   volume 中的路径写到宿主机目录
+3）查看文件信息时通过 openat2 的 RESOLVE_IN_ROOT 在根目录中解析路径，打包和解压在 chroot 的子进程中进行，
+   容器中的进程在解析之后替换路径也不会读写到宿主机的文件
+*/
+type containerFs struct {
+	root    string    // 读取使用的目录
+	upper   string    // 停止的容器写入的目录，运行中的容器为空
+	volumes []*Volume // 停止的容器挂载到视图中的 volume
+	mounts  []string  // 视图的挂载点，关闭时逆序卸载
+}
+
+// openContainerFs 打开容器的文件系统，使用完需要调用 close
+func openContainerFs(info *Info) (*containerFs, error) {
+	if info.Status == RUNNING || info.Status == CREATED {
+		mounted, err := isMountPoint(getMerged(info.Id))
+		if err != nil {
+			return nil, err
+		}
+		if mounted {
+			return &containerFs{root: getMerged(info.Id)}, nil
+		}
+	}
+
+	view, err := os.MkdirTemp(getRoot(info.Id), "view-")
+	if err != nil {
+		return nil, err
+	}
+	cfs := &containerFs{root: view, upper: getUpper(info.Id)}
+	// 只有 lowerdir 时 overlayFs 是只读的，不需要 workdir，也不会和容器自己的挂载冲突
+	lowerDirs := append([]string{cfs.upper}, info.LowerDirs...)
+	if err = mountOverlay(view, unix.MS_RDONLY, "lowerdir="+strings.Join(lowerDirs, ":")); err != nil {
+		_ = os.Remove(view)
+		return nil, err
+	}
+	cfs.mounts = append(cfs.mounts, view)
+
+	for _, volume := range info.Volumes {
+		resolved, err := cfs.resolve(volume.Destination, true)
+		if err != nil {
+			_ = cfs.close()
+			return nil, err
+		}
+		if fi, err := cfs.lstat(resolved); err != nil || fi == nil || !fi.IsDir() {
+			logrus.Warnf("volume %s is not found in container %s, skip", volume.Destination, info.Id)
+			continue
+		}
+		if err = cfs.bindMount(volume.Source, resolved); err != nil {
+			_ = cfs.close()
+			return nil, err
+		}
+		// 挂载点是解析符号链接之后的路径
+		mounted := *volume
+		mounted.Destination = resolved
+		cfs.volumes = append(cfs.volumes, &mounted)
+	}
+	return cfs, nil
+}
+
+// bindMount 把宿主机的 source 绑定挂载到视图中的 p，通过文件描述符指定挂载点，挂载点不会落到视图以外
+func (cfs *containerFs) bindMount(source, p string) error {
+	file, err := cfs.open(p)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	target := filepath.Join(cfs.root, p)
+	if err = unix.Mount(source, fmt.Sprintf("/proc/self/fd/%d", file.Fd()), "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return &os.PathError{Op: "bind mount " + source, Path: target, Err: err}
+	}
+	cfs.mounts = append(cfs.mounts, target)
+	return nil
+}
+
+// close 卸载停止的容器的视图，可以重复调用
+func (cfs *containerFs) close() error {
+	for len(cfs.mounts) > 0 {
+		target := cfs.mounts[len(cfs.mounts)-1]
+		if err := unix.Unmount(target, unix.MNT_DETACH); err != nil {
+			return &os.PathError{Op: "umount", Path: target, Err: err}
+		}
+		cfs.mounts = cfs.mounts[:len(cfs.mounts)-1]
+	}
+	if cfs.upper == "" {
+		return nil
+	}
+	if err := os.Remove(cfs.root); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// open 以 O_PATH 打开容器中的路径，不跟随最后一级的符号链接
+// 符号链接和 .. 都由内核限制在根目录中解析，不会因为路径被替换成指向宿主机的符号链接而逃出根目录
+func (cfs *containerFs) open(p string) (*os.File, error) {
+	rootFd, err := unix.Open(cfs.root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: cfs.root, Err: err}
+	}
+	defer func() {
+		_ = unix.Close(rootFd)
+	}()
+	fd, err := unix.Openat2(rootFd, p, &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_NOFOLLOW | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_IN_ROOT | unix.RESOLVE_NO_MAGICLINKS,
+	})
+	if err != nil {
+		return nil, &os.PathError{Op: "openat2", Path: p, Err: err}
+	}
+	return os.NewFile(uintptr(fd), p), nil
+}
+
+// readlink 读取容器中符号链接的目标
+func (cfs *containerFs) readlink(p string) (string, error) {
+	file, err := cfs.open(p)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	buf := make([]byte, unix.PathMax)
+	n, err := unix.Readlinkat(int(file.Fd()), "", buf)
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: p, Err: err}
+	}
+	return string(buf[:n]), nil
+}
+
+// resolve 在容器的根目录中解析路径中的符号链接，绝对路径的符号链接相对于容器的根目录，.. 不会超出容器的根目录
+// 不存在的部分原样保留，followLast 为 false 时不解析最后一级
+func (cfs *containerFs) resolve(p string, followLast bool) (string, error) {
+	resolved := "/"
+	parts := strings.Split(p, "/")
+	links := 0
+	for len(parts) > 0 {
+		part := parts[0]
+		parts = parts[1:]
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, part)
+		if len(parts) == 0 && !followLast {
+			return next, nil
+		}
+		fi, err := cfs.lstat(next)
+		if err != nil {
+			return "", err
+		}
+		if fi == nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		if links++; links > maxSymlinks {
+			return "", &os.PathError{Op: "resolve", Path: p, Err: unix.ELOOP}
+		}
+		target, err := cfs.readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = "/"
+		}
+		parts = append(strings.Split(target, "/"), parts...)
+	}
+	return resolved, nil
+}
+
+// lstat 获取容器中文件的信息，文件不存在时返回 nil
+func (cfs *containerFs) lstat(p string) (os.FileInfo, error) {
+	file, err := cfs.open(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return file.Stat()
+}
+
+// copyUp 停止的容器写入 upper 目录前需要在 upper 中创建的父目录，stat 为视图中对应目录的信息
+type copyUp struct {
+	path string
+	stat *syscall.Stat_t
+}
+
+// writeDir 获取写入容器中的目录时 chroot 的目录、在其中解压的目录和解压选项
+// 停止的容器写到 upper 目录，同时返回 upper 中缺少的父目录，卸载视图后按照视图中的属主、权限依次创建
+func (cfs *containerFs) writeDir(dir string) (string, string, *archive.UntarOptions, []copyUp, error) {
+	if cfs.upper == "" {
+		return cfs.root, dir, nil, nil, nil
+	}
+	// volume 可能嵌套，使用挂载点最深的 volume
+	var target *Volume
+	for _, volume := range cfs.volumes {
+		if dir != volume.Destination && !strings.HasPrefix(dir, volume.Destination+"/") {
+			continue
+		}
+		if target == nil || len(volume.Destination) > len(target.Destination) {
+			target = volume
+		}
+	}
+	if target != nil {
+		if target.ReadOnly {
+			return "", "", nil, nil, fmt.Errorf("volume %s is read only", target.Destination)
+		}
+		return target.Source, filepath.Join("/", strings.TrimPrefix(dir, target.Destination)), nil, nil, nil
+	}
+
+	var parents []copyUp
+	current := "/"
+	for _, part := range strings.Split(strings.TrimPrefix(dir, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		current = filepath.Join(current, part)
+		upperPath := filepath.Join(cfs.upper, current)
+		if fi, err := os.Lstat(upperPath); err == nil {
+			if !fi.IsDir() {
+				return "", "", nil, nil, fmt.Errorf("%s is not a directory", current)
+			}
+			continue
+		}
+		fi, err := cfs.lstat(current)
+		if err != nil {
+			return "", "", nil, nil, err
+		}
+		if fi == nil || !fi.IsDir() {
+			return "", "", nil, nil, fmt.Errorf("%s is not a directory", current)
+		}
+		parents = append(parents, copyUp{path: upperPath, stat: fi.Sys().(*syscall.Stat_t)})
+	}
+	// 写入的目录替换了 upper 中的 whiteout 时，下层中被删除的内容仍然保持删除
+	return cfs.upper, dir, &archive.UntarOptions{OpaqueWhiteoutDirs: true}, parents, nil
+}
+
+// create 按照下层目录的属主、权限和修改时间在 upper 中创建目录
+func (c copyUp) create() error {
+	if err := os.Mkdir(c.path, 0700); err != nil {
+		return err
+	}
+	if err := os.Lchown(c.path, int(c.stat.Uid), int(c.stat.Gid)); err != nil {
+		return err
+	}
+	if err := unix.Chmod(c.path, c.stat.Mode&07777); err != nil {
+		return err
+	}
+	times := []unix.Timespec{unix.NsecToTimespec(c.stat.Atim.Nano()), unix.NsecToTimespec(c.stat.Mtim.Nano())}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, c.path, times, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+// copyTarget 根据源和目标计算解压的目录和源在 tar 中的名字，与 docker cp 一致：
+// 1）目标是已经存在的目录时复制到目录中，源以 /. 结尾时只复制目录中的内容
+// 2）目标是已经存在的文件时覆盖，源不能是目录
+// 3）目标不存在时以目标的名字创建，目标以 / 结尾时必须是已经存在的目录
+func copyTarget(src string, srcInfo os.FileInfo, dst string, dstInfo os.FileInfo) (string, string, error) {
+	contentsOnly := isContentsOnly(src)
+	switch {
+	case dstInfo != nil && dstInfo.IsDir():
+		if contentsOnly {
+			return dst, "", nil
+		}
+		return dst, filepath.Base(src), nil
+	case dstInfo != nil:
+		if srcInfo.IsDir() {
+			return "", "", fmt.Errorf("cannot copy a directory to file %s", dst)
+		}
+	case strings.HasSuffix(dst, "/") && !srcInfo.IsDir():
+		return "", "", fmt.Errorf("destination directory %s does not exist", dst)
+	}
+	cleaned := filepath.Clean(dst)
+	return filepath.Dir(cleaned), filepath.Base(cleaned), nil
+}
+
+// isContentsOnly 源以 /. 结尾或者是根目录时只复制目录中的内容
+func isContentsOnly(src string) bool {
+	return strings.HasSuffix(src, "/.") || filepath.Clean(src) == "/"
+}
+
+// followLast 源以 / 或 /. 结尾时必须是目录，需要解析最后一级的符号链接
+func followLast(src string, followLink bool) bool {
+	return followLink || strings.HasSuffix(src, "/") || strings.HasSuffix(src, "/.")
+}
+
+// CopyFrom 把容器中的 src 复制到宿主机的 dst，保留属主和权限
+// dst 为 - 时把 tar 流写到 out
+func CopyFrom(containerId, src, dst string, followLink bool, out io.Writer) error {
+	info, err := getInfoById(containerId)
+	if err != nil {
+		return err
+	}
+	cfs, err := openContainerFs(info)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := cfs.close(); err != nil {
+			logrus.Errorf("close container %s filesystem error, %v", containerId, err)
+		}
+	}()
+
+	resolved, err := cfs.resolve(src, followLast(src, followLink))
+	if err != nil {
+		return err
+	}
+	srcInfo, err := cfs.lstat(resolved)
+	if err != nil {
+		return err
+	}
+	if srcInfo == nil {
+		return fmt.Errorf("no such file or directory in container %s: %s", containerId, src)
+	}
+	if isContentsOnly(src) && !srcInfo.IsDir() {
+		return fmt.Errorf("%s is not a directory", src)
+	}
+	if dst == "-" {
+		name := filepath.Base(filepath.Clean(src))
+		if isContentsOnly(src) {
+			name = "."
+		}
+		return chrootTar(out, cfs.root, resolved, &archive.TarOptions{Name: name})
+	}
+
+	dstInfo, err := os.Stat(dst)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	dir, name, err := copyTarget(src, srcInfo, dst, dstInfo)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return fmt.Errorf("destination directory %s does not exist", dir)
+	}
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(chrootTar(writer, cfs.root, resolved, &archive.TarOptions{Name: name}))
+	}()
+	defer func() {
+		_ = reader.Close()
+	}()
+	if err = archive.Untar(reader, dir, nil); err != nil {
+		return fmt.Errorf("copy %s:%s to %s error, %v", containerId, src, dst, err)
+	}
+	return nil
+}
+
+// CopyTo 把宿主机的 src 复制到容器中的 dst，保留属主和权限
+// src 为 - 时从 in 读取 tar 流解压到容器中的 dst 目录
+// 停止的容器直接写入 upper 目录，写入前卸载容器的 overlayFs，启动时重新挂载以看到新的内容
+func CopyTo(containerId, src, dst string, followLink bool, in io.Reader) error {
+	info, err := getInfoById(containerId)
+	if err != nil {
+		return err
+	}
+	cfs, err := openContainerFs(info)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := cfs.close(); err != nil {
+			logrus.Errorf("close container %s filesystem error, %v", containerId, err)
+		}
+	}()
+
+	resolved, err := cfs.resolve(dst, true)
+	if err != nil {
+		return err
+	}
+	dstInfo, err := cfs.lstat(resolved)
+	if err != nil {
+		return err
+	}
+
+	var reader io.ReadCloser
+	dir := resolved
+	if src == "-" {
+		if dstInfo == nil || !dstInfo.IsDir() {
+			return fmt.Errorf("destination %s must be a directory", dst)
+		}
+		reader = io.NopCloser(in)
+	} else {
+		follow := followLast(src, followLink)
+		srcInfo, err := os.Lstat(src)
+		if err == nil && follow {
+			srcInfo, err = os.Stat(src)
+		}
+		if err != nil {
+			return err
+		}
+		if isContentsOnly(src) && !srcInfo.IsDir() {
+			return fmt.Errorf("%s is not a directory", src)
+		}
+		// 保留目标结尾的 /，表示目标必须是目录
+		target := resolved
+		if strings.HasSuffix(dst, "/") {
+			target += "/"
+		}
+		var name string
+		if dir, name, err = copyTarget(src, srcInfo, target, dstInfo); err != nil {
+			return err
+		}
+		srcPath := src
+		if follow {
+			if srcPath, err = filepath.EvalSymlinks(src); err != nil {
+				return err
+			}
+		}
+		reader = archive.Tar(srcPath, &archive.TarOptions{Name: name})
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	if fi, err := cfs.lstat(dir); err != nil || fi == nil || !fi.IsDir() {
+		return fmt.Errorf("destination directory %s does not exist in container %s", dir, containerId)
+	}
+	root, writeDir, opts, parents, err := cfs.writeDir(dir)
+	if err != nil {
+		return err
+	}
+	if cfs.upper != "" {
+		// overlay 挂载时修改它的 upper 或者 lower 目录是未定义行为，写入前卸载容器的 overlayFs 和视图
+		if err = UmountWorkSpace(info.Volumes, containerId); err != nil {
+			return err
+		}
+		if err = cfs.close(); err != nil {
+			return err
+		}
+		for _, parent := range parents {
+			if err = parent.create(); err != nil {
+				return err
+			}
+		}
+	}
+	if err = chrootUntar(reader, root, writeDir, opts); err != nil {
+		return fmt.Errorf("copy %s to %s:%s error, %v", src, containerId, dst, err)
+	}
+	return nil
+}
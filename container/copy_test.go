@@ -0,0 +1,103 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerFs_Resolve(t *testing.T) {
+	ast := assert.New(t)
+	root := t.TempDir()
+	ast.Nil(os.MkdirAll(filepath.Join(root, "etc/conf"), 0755))
+	ast.Nil(os.Symlink("/etc", filepath.Join(root, "abs")))
+	ast.Nil(os.Symlink("etc/conf", filepath.Join(root, "rel")))
+	ast.Nil(os.Symlink("../../../../..", filepath.Join(root, "escape")))
+	ast.Nil(os.Symlink("loop", filepath.Join(root, "loop")))
+	cfs := &containerFs{root: root}
+
+	for p, expected := range map[string]string{
+		"/etc/conf":         "/etc/conf",
+		"/abs/conf":         "/etc/conf",
+		"/rel/../hostname":  "/etc/hostname",
+		"/escape/etc":       "/etc",
+		"/escape/../../abs": "/etc",
+		"abs/missing/file":  "/etc/missing/file",
+		"/":                 "/",
+	} {
+		resolved, err := cfs.resolve(p, true)
+		ast.Nil(err, p)
+		ast.Equal(expected, resolved, p)
+	}
+
+	// 不解析最后一级的符号链接
+	resolved, err := cfs.resolve("/abs", false)
+	ast.Nil(err)
+	ast.Equal("/abs", resolved)
+
+	_, err = cfs.resolve("/loop", true)
+	ast.NotNil(err)
+}
+
+func TestContainerFs_LstatInRoot(t *testing.T) {
+	ast := assert.New(t)
+	root := t.TempDir()
+	ast.Nil(os.MkdirAll(filepath.Join(root, "etc"), 0755))
+	ast.Nil(os.WriteFile(filepath.Join(root, "etc/hostname"), []byte("mydocker"), 0644))
+	ast.Nil(os.Symlink("/", filepath.Join(root, "host")))
+	ast.Nil(os.Symlink("/etc/hostname", filepath.Join(root, "hostname")))
+	cfs := &containerFs{root: root}
+
+	// 路径中的符号链接在根目录中解析，不会读到宿主机的 /proc
+	fi, err := cfs.lstat("/host/proc/self")
+	ast.Nil(err)
+	ast.Nil(fi)
+	fi, err = cfs.lstat("/host/etc/hostname")
+	ast.Nil(err)
+	ast.False(fi.IsDir())
+
+	// 最后一级的符号链接不跟随
+	fi, err = cfs.lstat("/hostname")
+	ast.Nil(err)
+	ast.NotZero(fi.Mode() & os.ModeSymlink)
+	target, err := cfs.readlink("/hostname")
+	ast.Nil(err)
+	ast.Equal("/etc/hostname", target)
+}
+
+func TestCopyTarget(t *testing.T) {
+	ast := assert.New(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	ast.Nil(os.WriteFile(file, nil, 0644))
+	dirInfo, _ := os.Stat(dir)
+	fileInfo, _ := os.Stat(file)
+
+	// 目标是已经存在的目录
+	target, name, err := copyTarget("/etc/hostname", fileInfo, "/tmp", dirInfo)
+	ast.Nil(err)
+	ast.Equal("/tmp", target)
+	ast.Equal("hostname", name)
+	target, name, err = copyTarget("/etc/.", dirInfo, "/tmp", dirInfo)
+	ast.Nil(err)
+	ast.Equal("/tmp", target)
+	ast.Equal("", name)
+
+	// 目标是已经存在的文件
+	target, name, err = copyTarget("/etc/hostname", fileInfo, "/tmp/name", fileInfo)
+	ast.Nil(err)
+	ast.Equal("/tmp", target)
+	ast.Equal("name", name)
+	_, _, err = copyTarget("/etc", dirInfo, "/tmp/name", fileInfo)
+	ast.NotNil(err)
+
+	// 目标不存在
+	target, name, err = copyTarget("/etc", dirInfo, "/tmp/conf/", nil)
+	ast.Nil(err)
+	ast.Equal("/tmp", target)
+	ast.Equal("conf", name)
+	_, _, err = copyTarget("/etc/hostname", fileInfo, "/tmp/conf/", nil)
+	ast.NotNil(err)
+}
@@ -0,0 +1,15 @@
+package container
+
+import (
+	"github.com/pjimming/mydocker/archive"
+)
+
+// Diff 获取容器的文件系统相对于镜像的改动
+// 改动都在容器的 upper 目录中，不需要挂载 overlayFs，运行中和停止的容器都可以使用
+func Diff(containerId string) ([]archive.Change, error) {
+	info, err := getInfoById(containerId)
+	if err != nil {
+		return nil, err
+	}
+	return archive.OverlayChanges(getUpper(containerId), info.LowerDirs)
+}
@@ -0,0 +1,32 @@
+package container
+
+import (
+	"io"
+
+	"github.com/pjimming/mydocker/archive"
+)
+
+// Export 把容器的 rootfs 打包成 tar 流，不包含数据卷中的内容
+// 宿主机重启后停止的容器的 overlayFs 可能已经卸载，此时重新挂载
+func Export(containerId string) (io.ReadCloser, error) {
+	info, err := getInfoById(containerId)
+	if err != nil {
+		return nil, err
+	}
+	mntPath := getMerged(containerId)
+	mounted, err := isMountPoint(mntPath)
+	if err != nil {
+		return nil, err
+	}
+	if !mounted {
+		if err = mountOverlayFs(containerId, info.LowerDirs); err != nil {
+			return nil, err
+		}
+	}
+
+	excluded := make([]string, 0, len(info.Volumes))
+	for _, volume := range info.Volumes {
+		excluded = append(excluded, volume.Destination)
+	}
+	return archive.Tar(mntPath, &archive.TarOptions{ExcludeContents: excluded}), nil
+}
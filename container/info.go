@@ -4,69 +4,160 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"strconv"
-	"strings"
+	"syscall"
 	"time"
 
+	"github.com/pjimming/mydocker/cgroups/subsystems"
 	"github.com/pjimming/mydocker/utils/jsonx"
 
 	"github.com/sirupsen/logrus"
 )
 
 type Info struct {
-	Pid         string   `json:"pid"`         // 容器的init进程在宿主机上的 PID
-	Id          string   `json:"id"`          // 容器Id
-	Name        string   `json:"name"`        // 容器名
-	Command     string   `json:"command"`     // 容器内init运行命令
-	CreatedTime string   `json:"createTime"`  // 创建时间
-	Status      string   `json:"status"`      // 容器的状态
-	Volume      string   `json:"volume"`      // 挂载的数据卷
-	PortMapping []string `json:"portMapping"` // 端口映射
+	Pid            string                     `json:"pid"`            // 容器的init进程在宿主机上的 PID
+	Id             string                     `json:"id"`             // 容器Id
+	Name           string                     `json:"name"`           // 容器名
+	Command        string                     `json:"command"`        // 容器内init运行命令
+	Entrypoint     []string                   `json:"entrypoint"`     // 通过 --entrypoint 指定的入口命令，nil 表示使用镜像的 Entrypoint
+	Args           []string                   `json:"args"`           // 容器内运行的命令及参数
+	WorkingDir     string                     `json:"workingDir"`     // 用户命令的工作目录
+	Hostname       string                     `json:"hostname"`       // 容器的主机名
+	User           string                     `json:"user"`           // 运行命令的用户
+	Init           bool                       `json:"init"`           // 是否使用 mydocker 作为容器的 1 号进程
+	Tty            bool                       `json:"tty"`            // 是否通过 -it 在前台运行，重新启动时保持原来的运行方式
+	CreatedTime    string                     `json:"createTime"`     // 创建时间
+	StartedTime    string                     `json:"startedTime"`    // 最近一次启动时间
+	Status         string                     `json:"status"`         // 容器的状态
+	ExitCode       int                        `json:"exitCode"`       // 容器init进程的退出码
+	FinishedTime   string                     `json:"finishedTime"`   // 容器退出时间
+	OOMKilled      bool                       `json:"oomKilled"`      // 容器是否因为内存超限被杀死
+	Image          string                     `json:"image"`          // 容器使用的镜像
+	ImageId        string                     `json:"imageId"`        // 容器使用的镜像Id
+	LowerDirs      []string                   `json:"lowerDirs"`      // 镜像各层的目录，作为 overlay 的 lowerdir
+	Env            []string                   `json:"env"`            // 镜像和用户指定的环境变量
+	Volumes        []*Volume                  `json:"volumes"`        // 挂载的数据卷
+	Tmpfs          []*Tmpfs                   `json:"tmpfs"`          // 挂载的 tmpfs
+	ResourceConfig *subsystems.ResourceConfig `json:"resourceConfig"` // 资源限制
+	CgroupPath     string                     `json:"cgroupPath"`     // 容器的 cgroup 路径
+	NetworkName    string                     `json:"networkName"`    // 容器所连接的网络
+	IP             string                     `json:"ip"`             // 容器在网络中分配到的IP
+	PortMapping    []string                   `json:"portMapping"`    // 端口映射
 }
 
-// RecordInfo 记录容器相关信息
-func RecordInfo(containerPid int, commandArray []string, containerName, containerId, volume string) error {
-	if containerName == "" {
-		containerName = containerId
+// RecordInfo 记录容器相关信息，此时容器处于 created 状态
+// 重新启动已经停止的容器时保留原来的创建时间
+func RecordInfo(containerInfo *Info) error {
+	if containerInfo.Name == "" {
+		containerInfo.Name = containerInfo.Id
 	}
-	command := strings.Join(commandArray, "")
-	containerInfo := &Info{
-		Pid:         strconv.Itoa(containerPid),
-		Id:          containerId,
-		Name:        containerName,
-		Command:     command,
-		CreatedTime: time.Now().Format(time.DateTime),
-		Status:      RUNNING,
-		Volume:      volume,
+	if containerInfo.CreatedTime == "" {
+		containerInfo.CreatedTime = time.Now().Format(time.DateTime)
 	}
+	containerInfo.Status = CREATED
 
-	infoStr, err := jsonx.ToJsonString(containerInfo)
-	if err != nil {
-		err = fmt.Errorf("to json string fail, %v", err)
+	dirPath := getContainerDir(containerInfo.Id)
+	if err := os.MkdirAll(dirPath, 0622); err != nil {
+		err = fmt.Errorf("mkdir all fail, %v", err)
 		logrus.Error(err)
 		return err
 	}
+	return writeInfo(containerInfo)
+}
 
-	dirPath := getContainerDir(containerId)
-	if err = os.MkdirAll(dirPath, 0622); err != nil {
-		err = fmt.Errorf("mkdir all fail, %v", err)
-		logrus.Error(err)
+// UpdateInfo 读取容器信息，交给 update 修改后写回
+// 容器的监控进程和 stop 等命令可能同时修改 config.json，因此修改期间对容器目录加文件锁
+func UpdateInfo(containerId string, update func(info *Info) error) error {
+	dir, err := os.Open(getContainerDir(containerId))
+	if err != nil {
+		logrus.Errorf("[UpdateInfo][id=%s] open container dir error, %v", containerId, err)
+		return err
+	}
+	defer func() {
+		_ = dir.Close()
+	}()
+	if err = syscall.Flock(int(dir.Fd()), syscall.LOCK_EX); err != nil {
+		logrus.Errorf("[UpdateInfo][id=%s] lock container dir error, %v", containerId, err)
 		return err
 	}
+	defer func() {
+		_ = syscall.Flock(int(dir.Fd()), syscall.LOCK_UN)
+	}()
 
-	fileName := path.Join(dirPath, ConfigName)
-	file, err := os.Create(fileName)
+	info, err := getInfoById(containerId)
+	if err != nil {
+		return err
+	}
+	if err = update(info); err != nil {
+		return err
+	}
+	return writeInfo(info)
+}
+
+// RecordExit 记录容器init进程的退出信息
+// 通过 stop 停止的容器保持 stopped 状态，自己退出的容器变为 exited 状态
+func RecordExit(containerId string, exitCode int, oomKilled bool) error {
+	return UpdateInfo(containerId, func(info *Info) error {
+		if info.Status != STOP {
+			info.Status = Exit
+		}
+		info.Pid = ""
+		info.ExitCode = exitCode
+		info.OOMKilled = oomKilled
+		info.FinishedTime = time.Now().Format(time.DateTime)
+		return nil
+	})
+}
+
+// AcquireMonitorLock 容器的 monitor 进程在等待容器退出期间一直持有 monitor.lock 文件锁，
+// monitor 进程退出后由内核自动释放，其他命令可以据此判断容器的退出状态是否已经记录完成
+func AcquireMonitorLock(containerId string) (*os.File, error) {
+	lockFile, err := os.OpenFile(path.Join(getContainerDir(containerId), monitorLockName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		_ = lockFile.Close()
+		return nil, err
+	}
+	return lockFile, nil
+}
+
+// WaitMonitorExit 等待容器的 monitor 进程退出，超时返回错误
+func WaitMonitorExit(containerId string, timeout time.Duration) error {
+	lockFile, err := os.OpenFile(path.Join(getContainerDir(containerId), monitorLockName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
 	defer func() {
-		_ = file.Close()
+		_ = lockFile.Close()
 	}()
 
+	deadline := time.Now().Add(timeout)
+	for {
+		err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			return syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+		}
+		if err != syscall.EWOULDBLOCK {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("container %s did not exit in %s", containerId, timeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func writeInfo(containerInfo *Info) error {
+	infoStr, err := jsonx.ToJsonString(containerInfo)
 	if err != nil {
-		err = fmt.Errorf("create file %s fail, %v", fileName, err)
+		err = fmt.Errorf("to json string fail, %v", err)
 		logrus.Error(err)
 		return err
 	}
 
-	if _, err = file.WriteString(infoStr); err != nil {
+	fileName := path.Join(getContainerDir(containerInfo.Id), ConfigName)
+	if err = os.WriteFile(fileName, []byte(infoStr), 0622); err != nil {
 		err = fmt.Errorf("write file %s fail, %v", fileName, err)
 		logrus.Error(err)
 		return err
@@ -83,6 +174,14 @@ func DeleteInfo(containerId string) error {
 	return nil
 }
 
+// GetCgroupPath 获取容器的 cgroup 路径，即 {cgroupParent}/{containerId}
+func GetCgroupPath(cgroupParent, containerId string) string {
+	if cgroupParent == "" {
+		cgroupParent = CgroupParent
+	}
+	return path.Join(cgroupParent, containerId)
+}
+
 // ReadInfo 根据containerId读取信息
 func ReadInfo(containerId string) (*Info, error) {
 	return getInfoById(containerId)
@@ -1,6 +1,7 @@
 package container
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -16,6 +17,19 @@ const (
 	readPipeFdIndex = 3
 )
 
+// InitSpec 父进程通过管道传递给容器init进程的启动参数，以json格式传输
+// 相比按空格拼接的字符串，可以正确传递带空格或者为空的参数
+type InitSpec struct {
+	Args     []string  `json:"args"`     // 用户命令及参数
+	Env      []string  `json:"env"`      // 用户指定的环境变量
+	Cwd      string    `json:"cwd"`      // 用户命令的工作目录
+	Hostname string    `json:"hostname"` // 容器的主机名
+	User     string    `json:"user"`     // 运行用户命令的用户，格式为 user[:group]
+	Init     bool      `json:"init"`     // 是否由 mydocker 作为 1 号进程转发信号并回收僵尸进程
+	Volumes  []*Volume `json:"volumes"`  // 容器挂载的数据卷，rshared 的数据卷需要保持共享
+	Tmpfs    []*Tmpfs  `json:"tmpfs"`    // 需要在容器中挂载的 tmpfs
+}
+
 // RunContainerInitProcess 启动容器的init进程
 /*
 这里的init函数是在容器内部执行的，也就是说，代码执行到这里后，容器所在的进程其实就已经创建出来了，
@@ -23,30 +37,96 @@ const (
 使用mount先去挂载proc文件系统，以便后面通过ps等系统命令去查看当前进程资源的情况。
 */
 func RunContainerInitProcess() error {
-	// mount -t proc proc /proc
-	mountProc()
-
 	// read pipe
-	cmdArray := readUserCommand()
-	if cmdArray == nil || len(cmdArray) <= 0 {
+	spec, err := readInitSpec()
+	if err != nil {
+		return fmt.Errorf("run container get init spec fail, %v", err)
+	}
+
+	// mount -t proc proc /proc
+	if err = mountProc(spec.Volumes); err != nil {
+		logrus.Errorf("mount proc error %v", err)
+		return err
+	}
+	if err = mountTmpfs(spec.Tmpfs); err != nil {
+		logrus.Errorf("mount tmpfs error %v", err)
+		return err
+	}
+	if len(spec.Args) <= 0 {
 		return fmt.Errorf("run container get user command fail, command array is nil")
 	}
 
-	path, err := exec.LookPath(cmdArray[0])
+	if err = setupInitSpec(spec); err != nil {
+		logrus.Errorf("setup init spec error %v", err)
+		return err
+	}
+
+	path, err := exec.LookPath(spec.Args[0])
 	if err != nil {
 		logrus.Errorf("Exec loop path error %v", err)
 		return err
 	}
 	logrus.Infof("Find path %s", path)
 
-	if err = syscall.Exec(path, cmdArray[0:], os.Environ()); err != nil {
+	if spec.Init {
+		exitCode, err := runAsInit(path, spec.Args)
+		if err != nil {
+			logrus.Errorf("run user command as init fail, %v", err)
+			return err
+		}
+		os.Exit(exitCode)
+	}
+
+	if err = syscall.Exec(path, spec.Args, os.Environ()); err != nil {
 		logrus.Errorf("exec command fail, %v", err)
 		return err
 	}
 	return nil
 }
 
-func readUserCommand() []string {
+// setupInitSpec 在执行用户命令前设置环境变量、主机名、工作目录和用户
+func setupInitSpec(spec *InitSpec) error {
+	// 先设置环境变量，这样 LookPath 会使用用户指定的 PATH
+	for _, env := range spec.Env {
+		key, value, _ := strings.Cut(env, "=")
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("set env %s error, %v", env, err)
+		}
+	}
+	if spec.Hostname != "" {
+		if err := syscall.Sethostname([]byte(spec.Hostname)); err != nil {
+			return fmt.Errorf("set hostname %s error, %v", spec.Hostname, err)
+		}
+	}
+	if spec.Cwd != "" {
+		// 与 docker 一致，工作目录不存在时自动创建
+		if err := os.MkdirAll(spec.Cwd, 0755); err != nil {
+			return fmt.Errorf("mkdir %s error, %v", spec.Cwd, err)
+		}
+		if err := os.Chdir(spec.Cwd); err != nil {
+			return fmt.Errorf("chdir %s error, %v", spec.Cwd, err)
+		}
+	}
+	if spec.User != "" {
+		uid, gid, err := lookupUser(spec.User)
+		if err != nil {
+			return err
+		}
+		// 切换用户的顺序必须是 groups -> gid -> uid，切换 uid 之后就没有权限再修改 gid 了
+		if err = syscall.Setgroups([]int{}); err != nil {
+			return fmt.Errorf("setgroups error, %v", err)
+		}
+		if err = syscall.Setgid(gid); err != nil {
+			return fmt.Errorf("setgid %d error, %v", gid, err)
+		}
+		if err = syscall.Setuid(uid); err != nil {
+			return fmt.Errorf("setuid %d error, %v", uid, err)
+		}
+	}
+	return nil
+}
+
+func readInitSpec() (*InitSpec, error) {
 	// uintptr(3)就是指 index 为3的文件描述符，也就是传递进来的管道的另一端，至于为什么是3，具体解释如下：
 	/*	因为每个进程默认都会有3个文件描述符，分别是标准输入、标准输出、标准错误。这3个是子进程一创建的时候就会默认带着的，
 		前面通过ExtraFiles方式带过来的 readPipe 理所当然地就成为了第4个。
@@ -67,28 +147,37 @@ func readUserCommand() []string {
 	msg, err := io.ReadAll(pipe)
 	if err != nil {
 		logrus.Errorf("read pipe fail, %v", err)
-		return nil
+		return nil, err
+	}
+	spec := new(InitSpec)
+	if err = json.Unmarshal(msg, spec); err != nil {
+		logrus.Errorf("unmarshal init spec fail, %v", err)
+		return nil, err
 	}
-	return strings.Split(string(msg), " ")
+	return spec, nil
 }
 
-func mountProc() {
+// mountProc 切换到容器的根目录并挂载 proc，任何一步失败都返回错误
+// 切换根目录失败时后面的 tmpfs 会挂载到宿主机的目录上，因此调用方必须停止初始化
+func mountProc(volumes []*Volume) error {
 	pwd, err := os.Getwd()
 	if err != nil {
 		logrus.Errorf("os getwd fail, %v", err)
-		return
+		return err
 	}
 
 	logrus.Infof("Current location is %s", pwd)
 
 	// systemd 加入linux之后, mount namespace 就变成 shared by default, 所以你必须显示声明你要这个新的mount namespace独立。
-	// 即 mount proc 之前先把所有挂载点的传播类型改为 private，避免本 namespace 中的挂载事件外泄。
-	// 把所有挂载点的传播类型改为 private，避免本 namespace 中的挂载事件外泄。
-	_ = syscall.Mount("", "/", "", syscall.MS_PRIVATE|syscall.MS_REC, "")
+	// 即 mount proc 之前先把挂载点的传播类型改为 slave，避免本 namespace 中的挂载事件外泄。
+	if err = makeMountsSlave(pwd, volumes); err != nil {
+		logrus.Errorf("make mounts slave fail, %v", err)
+		return err
+	}
 
 	if err = pivotRoot(pwd); err != nil {
 		logrus.Errorf("pivot_root fail, %v", err)
-		return
+		return err
 	}
 
 	// 如果不先做 private mount，会导致挂载事件外泄，后续再执行 mydocker 命令时 /proc 文件系统异常
@@ -98,7 +187,28 @@ func mountProc() {
 	// MS_NOSUID 在本系统中运行程序的时候，不允许 set-user-ID 或 set-group-ID
 	// MS_NOD 这个参数是自 Linux 2.4 ，所有 mount 的系统都会默认设定的参数。
 	defaultMountFlags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
-	_ = syscall.Mount("proc", "/proc", "proc", uintptr(defaultMountFlags), "")
+	if err = syscall.Mount("proc", "/proc", "proc", uintptr(defaultMountFlags), ""); err != nil {
+		return &os.PathError{Op: "mount proc", Path: "/proc", Err: err}
+	}
+	return nil
+}
+
+// makeMountsSlave 把当前 mount namespace 中的挂载点递归改为 slave，再按数据卷的选项设置数据卷的挂载传播类型
+// 改为 slave 后宿主机上的挂载事件仍然会传播到容器中，rshared 数据卷还会在容器内的挂载点之间相互传播
+func makeMountsSlave(root string, volumes []*Volume) error {
+	if err := syscall.Mount("", "/", "", syscall.MS_SLAVE|syscall.MS_REC, ""); err != nil {
+		return &os.PathError{Op: "make mounts rslave", Path: "/", Err: err}
+	}
+	for _, volume := range volumes {
+		if volume.Propagation != PropagationRShared {
+			continue
+		}
+		target := filepath.Join(root, volume.Destination)
+		if err := syscall.Mount("", target, "", volume.propagationFlag(), ""); err != nil {
+			return &os.PathError{Op: "set propagation " + volume.Propagation, Path: target, Err: err}
+		}
+	}
+	return nil
 }
 
 func pivotRoot(root string) error {
@@ -0,0 +1,158 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// LogMaxSize 单个日志文件的最大字节数，超过后进行轮转
+	LogMaxSize = 10 * 1024 * 1024
+	// LogMaxFiles 最多保留的日志文件数，包括正在写入的 container.log
+	LogMaxFiles = 3
+	// logMaxLineSize 单行日志的最大长度，超过后作为一条不完整的日志先写入
+	logMaxLineSize = 16 * 1024
+
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// LogEntry 与 docker json-file 日志驱动相同的日志格式，每行一个 json
+type LogEntry struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// jsonLogger 把容器的标准输出、标准错误以 json-file 格式写入 container.log，按大小轮转
+// container.log 写满后依次重命名为 container.log.1、container.log.2 ...
+type jsonLogger struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	size     int64
+	maxSize  int64
+	maxFiles int
+}
+
+func newJsonLogger(logPath string, maxSize int64, maxFiles int) (*jsonLogger, error) {
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &jsonLogger{
+		path:     logPath,
+		file:     file,
+		size:     stat.Size(),
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}, nil
+}
+
+// Stream 返回写入指定输出流的 io.Writer，可以直接作为 exec.Cmd 的 Stdout、Stderr
+func (l *jsonLogger) Stream(stream string) *logStream {
+	return &logStream{logger: l, stream: stream}
+}
+
+func (l *jsonLogger) write(entry *LogEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err = l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// rotate 轮转日志文件，丢弃最旧的文件
+func (l *jsonLogger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	for i := l.maxFiles - 1; i > 0; i-- {
+		src := l.path
+		if i > 1 {
+			src = fmt.Sprintf("%s.%d", l.path, i-1)
+		}
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", l.path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	l.file = file
+	l.size = 0
+	return nil
+}
+
+func (l *jsonLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// logStream 把写入的数据按行拆分成日志记录，不完整的行先缓存起来
+type logStream struct {
+	logger *jsonLogger
+	stream string
+	buf    []byte
+}
+
+func (s *logStream) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := s.emit(s.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		s.buf = s.buf[i+1:]
+	}
+	if len(s.buf) >= logMaxLineSize {
+		if err := s.emit(s.buf); err != nil {
+			return 0, err
+		}
+		s.buf = nil
+	}
+	return len(p), nil
+}
+
+// Close 把缓存中最后一行不完整的日志写入文件
+func (s *logStream) Close() error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	err := s.emit(s.buf)
+	s.buf = nil
+	return err
+}
+
+func (s *logStream) emit(line []byte) error {
+	return s.logger.write(&LogEntry{
+		Log:    string(line),
+		Stream: s.stream,
+		Time:   time.Now().UTC(),
+	})
+}
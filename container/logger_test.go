@@ -0,0 +1,46 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJsonLogger_Rotate(t *testing.T) {
+	ast := assert.New(t)
+	logPath := filepath.Join(t.TempDir(), LogFile)
+
+	logger, err := newJsonLogger(logPath, 256, 3)
+	ast.Nil(err)
+	stdout := logger.Stream(StreamStdout)
+	for i := 0; i < 20; i++ {
+		_, err = fmt.Fprintf(stdout, "line %d\n", i)
+		ast.Nil(err)
+	}
+	_, err = stdout.Write([]byte("partial"))
+	ast.Nil(err)
+	ast.Nil(stdout.Close())
+	ast.Nil(logger.Close())
+
+	_, err = os.Stat(logPath + ".1")
+	ast.Nil(err)
+	_, err = os.Stat(logPath + ".2")
+	ast.Nil(err)
+	_, err = os.Stat(logPath + ".3")
+	ast.True(os.IsNotExist(err))
+
+	file, err := os.Open(logPath)
+	ast.Nil(err)
+	defer file.Close()
+	entries, _, err := scanLogEntries(file, bufio.NewReader(file), 0, time.Time{})
+	ast.Nil(err)
+	ast.NotEmpty(entries)
+	last := entries[len(entries)-1]
+	ast.Equal("partial", last.Log)
+	ast.Equal(StreamStdout, last.Stream)
+}
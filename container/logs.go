@@ -1,32 +1,187 @@
 package container
 
 import (
+	"bufio"
+	"encoding/json"
 	"fmt"
-	"github.com/sirupsen/logrus"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
-func Log(containerId string) error {
+// followInterval logs -f 检查日志文件是否有新内容的间隔
+const followInterval = 200 * time.Millisecond
+
+// LogOptions logs 命令的参数
+type LogOptions struct {
+	Follow     bool      // 持续输出新产生的日志，直到容器退出
+	Tail       int       // 只输出最后 Tail 行，小于 0 表示输出全部
+	Since      time.Time // 只输出该时间之后的日志
+	Timestamps bool      // 输出日志的时间戳
+}
+
+func Log(containerId string, opts *LogOptions) error {
 	logFilePath := filepath.Join(getContainerDir(containerId), LogFile)
+
+	// 先读取已经轮转的文件，再读取正在写入的 container.log
+	var entries []*LogEntry
+	for i := LogMaxFiles - 1; i > 0; i-- {
+		rotated, err := readLogEntries(fmt.Sprintf("%s.%d", logFilePath, i), opts.Since)
+		if err != nil && !os.IsNotExist(err) {
+			logrus.Errorf("[Log] read rotated log %s.%d error, %v", logFilePath, i, err)
+			return err
+		}
+		entries = append(entries, rotated...)
+	}
+
 	file, err := os.Open(logFilePath)
-	defer func() {
-		_ = file.Close()
-	}()
 	if err != nil {
 		logrus.Errorf("[Log] open %s error, %v", logFilePath, err)
 		return err
 	}
-	content, err := io.ReadAll(file)
+	defer func() {
+		_ = file.Close()
+	}()
+	reader := bufio.NewReader(file)
+	current, offset, err := scanLogEntries(file, reader, 0, opts.Since)
 	if err != nil {
 		logrus.Errorf("[Log] read file %s error %v", logFilePath, err)
 		return err
 	}
-	_, err = fmt.Fprint(os.Stdout, string(content))
+	entries = append(entries, current...)
+
+	if opts.Tail >= 0 && len(entries) > opts.Tail {
+		entries = entries[len(entries)-opts.Tail:]
+	}
+	for _, entry := range entries {
+		if err = printLogEntry(entry, opts.Timestamps); err != nil {
+			logrus.Errorf("[Log] Fprint error %v", err)
+			return err
+		}
+	}
+
+	if !opts.Follow {
+		return nil
+	}
+	return followLog(containerId, logFilePath, file, reader, offset, opts)
+}
+
+// followLog 类似 tail -f，轮询日志文件输出新增的日志，容器不再运行时退出
+// 日志文件被轮转后先把旧文件读到结尾，再重新打开 container.log 从头读取
+func followLog(containerId, logFilePath string, file *os.File, reader *bufio.Reader, offset int64, opts *LogOptions) error {
+	for {
+		entries, next, err := scanLogEntries(file, reader, offset, opts.Since)
+		if err != nil {
+			return err
+		}
+		offset = next
+		if err = printLogEntries(entries, opts.Timestamps); err != nil {
+			return err
+		}
+
+		if stat, err := os.Stat(logFilePath); err == nil && (stat.Size() < offset || !sameFile(file, stat)) {
+			// 上面读取之后、轮转之前写入旧文件的日志还没有输出
+			if !sameFile(file, stat) {
+				if entries, _, err = scanLogEntries(file, reader, offset, opts.Since); err != nil {
+					return err
+				}
+				if err = printLogEntries(entries, opts.Timestamps); err != nil {
+					return err
+				}
+			}
+			_ = file.Close()
+			if file, err = os.Open(logFilePath); err != nil {
+				return err
+			}
+			reader.Reset(file)
+			offset = 0
+			continue
+		}
+
+		if len(entries) == 0 {
+			info, err := getInfoById(containerId)
+			if err != nil || (info.Status != RUNNING && info.Status != CREATED) {
+				_ = file.Close()
+				return nil
+			}
+			time.Sleep(followInterval)
+		}
+	}
+}
+
+func sameFile(file *os.File, stat os.FileInfo) bool {
+	current, err := file.Stat()
 	if err != nil {
-		logrus.Errorf("[Log] Fprint error %v", err)
-		return err
+		return false
+	}
+	return os.SameFile(current, stat)
+}
+
+func readLogEntries(logFilePath string, since time.Time) ([]*LogEntry, error) {
+	file, err := os.Open(logFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	entries, _, err := scanLogEntries(file, bufio.NewReader(file), 0, since)
+	return entries, err
+}
+
+// scanLogEntries 从 offset 开始读取完整的日志行并解析，返回读取完整行之后的 offset
+// 最后不完整的一行可能还在写入中，把文件位置退回到这一行的开头，下次再读
+// 不是 json 格式的行(旧版本直接写入的日志)原样输出
+func scanLogEntries(file *os.File, reader *bufio.Reader, offset int64, since time.Time) ([]*LogEntry, int64, error) {
+	var entries []*LogEntry
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err != io.EOF {
+				return nil, offset, err
+			}
+			if len(line) > 0 {
+				if _, err = file.Seek(offset, io.SeekStart); err != nil {
+					return nil, offset, err
+				}
+				reader.Reset(file)
+			}
+			return entries, offset, nil
+		}
+		offset += int64(len(line))
+
+		entry := new(LogEntry)
+		if err = json.Unmarshal(line, entry); err != nil {
+			entry = &LogEntry{Log: string(line), Stream: StreamStdout}
+		}
+		if !since.IsZero() && entry.Time.Before(since) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func printLogEntries(entries []*LogEntry, timestamps bool) error {
+	for _, entry := range entries {
+		if err := printLogEntry(entry, timestamps); err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+func printLogEntry(entry *LogEntry, timestamps bool) error {
+	out := os.Stdout
+	if entry.Stream == StreamStderr {
+		out = os.Stderr
+	}
+	if timestamps && !entry.Time.IsZero() {
+		_, err := fmt.Fprintf(out, "%s %s", entry.Time.Format(time.RFC3339Nano), entry.Log)
+		return err
+	}
+	_, err := fmt.Fprint(out, entry.Log)
+	return err
+}
@@ -0,0 +1,86 @@
+package container
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// runAsInit 以 --init 模式运行时，mydocker 自己作为容器的 1 号进程，类似 tini：
+// 1. fork 出用户命令作为子进程
+// 2. 把收到的信号转发给用户进程，1 号进程默认会忽略没有注册处理函数的信号，转发后用户进程按默认行为处理
+// 3. 回收容器内所有孤儿进程，避免僵尸进程堆积
+// 4. 用户进程退出后返回它的退出码，被信号杀死时与 shell 一样使用 128+信号值
+// 5. 在终端中运行时与 tini 一样把用户进程放到单独的前台进程组，避免用户进程收到终端和 1 号进程转发的两次 Ctrl-C
+func runAsInit(path string, args []string) (int, error) {
+	// 在启动子进程之前注册，避免错过子进程很快退出时的 SIGCHLD
+	sigs := make(chan os.Signal, 32)
+	signal.Notify(sigs)
+	defer signal.Stop(sigs)
+
+	attr := &os.ProcAttr{
+		Env:   os.Environ(),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+	}
+	if isForegroundTty(int(os.Stdin.Fd())) {
+		attr.Sys = &syscall.SysProcAttr{Setpgid: true, Foreground: true, Ctty: int(os.Stdin.Fd())}
+	}
+	child, err := os.StartProcess(path, args, attr)
+	if err != nil {
+		return -1, err
+	}
+	logrus.Infof("init process started user process %d", child.Pid)
+
+	for sig := range sigs {
+		switch sig {
+		case syscall.SIGCHLD:
+			if exitCode, exited := reapChildren(child.Pid); exited {
+				return exitCode, nil
+			}
+		case syscall.SIGURG:
+			// go runtime 用于抢占调度的信号，不转发
+		default:
+			if err = syscall.Kill(child.Pid, sig.(syscall.Signal)); err != nil && err != syscall.ESRCH {
+				logrus.Errorf("forward signal %s to %d error, %v", sig, child.Pid, err)
+			}
+		}
+	}
+	return -1, nil
+}
+
+// reapChildren 回收所有已经退出的子进程，用户进程退出时返回它的退出码
+func reapChildren(childPid int) (int, bool) {
+	exitCode, exited := 0, false
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if pid <= 0 || err != nil {
+			return exitCode, exited
+		}
+		if pid != childPid {
+			logrus.Infof("reaped zombie process %d", pid)
+			continue
+		}
+		exited = true
+		if status.Signaled() {
+			exitCode = 128 + int(status.Signal())
+		} else {
+			exitCode = status.ExitStatus()
+		}
+	}
+}
+
+// isForegroundTty 判断 fd 是否是当前进程的控制终端并且当前进程在终端的前台进程组中
+func isForegroundTty(fd int) bool {
+	pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil {
+		return false
+	}
+	return pgrp == unix.Getpgrp()
+}
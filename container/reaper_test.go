@@ -0,0 +1,40 @@
+package container
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestRunAsInit(t *testing.T) {
+	ast := assert.New(t)
+
+	code, err := runAsInit("/bin/sh", []string{"sh", "-c", "exit 3"})
+	ast.Nil(err)
+	ast.Equal(3, code)
+
+	// 被信号杀死的进程使用 128+信号值
+	code, err = runAsInit("/bin/sh", []string{"sh", "-c", "kill -TERM $$"})
+	ast.Nil(err)
+	ast.Equal(143, code)
+}
+
+func TestRunAsInitReapOrphans(t *testing.T) {
+	ast := assert.New(t)
+	// 测试进程不是 1 号进程，设置为 subreaper 后孤儿进程才会交给测试进程回收
+	ast.Nil(unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0))
+	defer func() {
+		_ = unix.Prctl(unix.PR_SET_CHILD_SUBREAPER, 0, 0, 0, 0)
+	}()
+
+	// 孙进程在用户进程退出前成为孤儿并退出，需要被回收，不影响用户进程的退出码
+	code, err := runAsInit("/bin/sh", []string{"sh", "-c", "(true &) ; sleep 0.2 ; exit 0"})
+	ast.Nil(err)
+	ast.Equal(0, code)
+
+	var status syscall.WaitStatus
+	pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+	ast.Equal(syscall.ECHILD, err, "zombie %d is not reaped", pid)
+}
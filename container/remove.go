@@ -1,6 +1,8 @@
 package container
 
 import (
+	"fmt"
+
 	"github.com/sirupsen/logrus"
 
 	"github.com/pjimming/mydocker/cgroups"
@@ -13,20 +15,22 @@ func Remove(id string) error {
 		return err
 	}
 
-	// 只能删除stopped的容器
-	if info.Status != STOP {
-		logrus.Errorf("[Remove][id=%s] can not remove, status is %s; pid is %s", id, info.Status, info.Pid)
-		return nil
+	// 只能删除stopped或者exited的容器
+	if info.Status != STOP && info.Status != Exit {
+		return fmt.Errorf("container %s is %s, stop it before removing", id, info.Status)
 	}
 
-	DeleteWorkSpace(info.Volume, id)
+	DeleteWorkSpace(info.Volumes, id)
 
 	// 删除宿主机上关于容器的子目录所有文件
 	if err = DeleteInfo(id); err != nil {
 		return err
 	}
 	logrus.Infof("remove container [%s] success", id)
-	if err = cgroups.NewCgroupManager("mydocker-cgroup").Destroy(); err != nil {
+	if info.CgroupPath == "" {
+		return nil
+	}
+	if err = cgroups.NewCgroupManager(info.CgroupPath).Destroy(); err != nil {
 		logrus.Errorf("cgroup rm fail, %v", err)
 	}
 	return nil
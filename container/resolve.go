@@ -0,0 +1,93 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ListInfos 读取所有容器的信息
+// InfoLoc 下除了容器目录还有 network 等其他目录，没有 config.json 的目录直接跳过
+func ListInfos() ([]*Info, error) {
+	dirs, err := os.ReadDir(infoRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		logrus.Errorf("[ListInfos] read dir %s fail, %v", infoRoot, err)
+		return nil, err
+	}
+
+	infos := make([]*Info, 0, len(dirs))
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		configFilePath := filepath.Join(getContainerDir(dir.Name()), ConfigName)
+		if _, err = os.Stat(configFilePath); err != nil {
+			continue
+		}
+		info, err := getInfoById(dir.Name())
+		if err != nil {
+			logrus.Errorf("[ListInfos] read %s info fail, %v", dir.Name(), err)
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// ResolveId 根据容器完整Id、容器名或者唯一的Id前缀找到容器Id
+// 匹配优先级与 docker 一致：完整Id > 容器名 > Id前缀
+func ResolveId(ref string) (string, error) {
+	if ref == "" {
+		return "", fmt.Errorf("container id or name is empty")
+	}
+	infos, err := ListInfos()
+	if err != nil {
+		return "", err
+	}
+
+	for _, info := range infos {
+		if info.Id == ref {
+			return info.Id, nil
+		}
+	}
+	for _, info := range infos {
+		if info.Name == ref {
+			return info.Id, nil
+		}
+	}
+
+	var matched []string
+	for _, info := range infos {
+		if strings.HasPrefix(info.Id, ref) {
+			matched = append(matched, info.Id)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return "", fmt.Errorf("no such container: %s", ref)
+	case 1:
+		return matched[0], nil
+	default:
+		return "", fmt.Errorf("container %s is ambiguous, matches %s", ref, strings.Join(matched, ", "))
+	}
+}
+
+// NameInUse 判断容器名是否已经被其他容器使用
+func NameInUse(name string) (bool, error) {
+	infos, err := ListInfos()
+	if err != nil {
+		return false, err
+	}
+	for _, info := range infos {
+		if info.Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,78 @@
+package container
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setupInfos 在临时目录中写入容器信息
+func setupInfos(t *testing.T, infos ...*Info) {
+	infoRoot = t.TempDir()
+	t.Cleanup(func() {
+		infoRoot = InfoLoc
+	})
+	for _, info := range infos {
+		content, err := json.Marshal(info)
+		assert.Nil(t, err)
+		assert.Nil(t, os.MkdirAll(getContainerDir(info.Id), 0755))
+		assert.Nil(t, os.WriteFile(filepath.Join(getContainerDir(info.Id), ConfigName), content, 0644))
+	}
+	// 没有 config.json 的目录不是容器
+	assert.Nil(t, os.MkdirAll(filepath.Join(infoRoot, "network"), 0755))
+}
+
+func TestResolveId(t *testing.T) {
+	ast := assert.New(t)
+	setupInfos(t,
+		&Info{Id: "1234567890", Name: "web"},
+		&Info{Id: "1234500000", Name: "1234567890"},
+		&Info{Id: "abcdef0000", Name: "db"},
+		&Info{Id: "9990000000", Name: "abcd"},
+	)
+
+	for _, tc := range []struct {
+		name     string
+		ref      string
+		expected string
+	}{
+		{name: "exact id beats name", ref: "1234567890", expected: "1234567890"},
+		{name: "name", ref: "web", expected: "1234567890"},
+		{name: "name beats prefix", ref: "abcd", expected: "9990000000"},
+		{name: "unique prefix", ref: "abc", expected: "abcdef0000"},
+		{name: "ambiguous prefix", ref: "12345"},
+		{name: "not found", ref: "network"},
+		{name: "empty", ref: ""},
+	} {
+		containerId, err := ResolveId(tc.ref)
+		if tc.expected == "" {
+			ast.NotNil(err, tc.name)
+			continue
+		}
+		ast.Nil(err, tc.name)
+		ast.Equal(tc.expected, containerId, tc.name)
+	}
+}
+
+func TestNameInUse(t *testing.T) {
+	ast := assert.New(t)
+	setupInfos(t,
+		&Info{Id: "1234567890", Name: "web"},
+		&Info{Id: "1234500000", Name: "1234567890"},
+	)
+
+	for name, expected := range map[string]bool{
+		"web":        true,
+		"1234567890": true,
+		"12345":      false,
+		"network":    false,
+		"db":         false,
+	} {
+		inUse, err := NameInUse(name)
+		ast.Nil(err, name)
+		ast.Equal(expected, inUse, name)
+	}
+}
@@ -0,0 +1,36 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxSignal linux 上最大的信号值，即 SIGRTMAX
+const maxSignal = 64
+
+// ParseSignal 解析信号，支持信号值(9)、完整的信号名(SIGKILL)和省略 SIG 前缀的信号名(kill)
+func ParseSignal(raw string) (syscall.Signal, error) {
+	if raw == "" {
+		return 0, fmt.Errorf("signal is empty")
+	}
+	if num, err := strconv.Atoi(raw); err == nil {
+		if num <= 0 || num > maxSignal {
+			return 0, fmt.Errorf("invalid signal %s", raw)
+		}
+		return syscall.Signal(num), nil
+	}
+
+	name := strings.ToUpper(raw)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return 0, fmt.Errorf("invalid signal %s", raw)
+	}
+	return sig, nil
+}
@@ -0,0 +1,28 @@
+package container
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSignal(t *testing.T) {
+	ast := assert.New(t)
+
+	for raw, want := range map[string]syscall.Signal{
+		"9":       syscall.SIGKILL,
+		"SIGTERM": syscall.SIGTERM,
+		"hup":     syscall.SIGHUP,
+		"SigUsr1": syscall.SIGUSR1,
+	} {
+		sig, err := ParseSignal(raw)
+		ast.Nil(err, raw)
+		ast.Equal(want, sig, raw)
+	}
+
+	for _, raw := range []string{"", "0", "-1", "1000", "SIGFOO"} {
+		_, err := ParseSignal(raw)
+		ast.NotNil(err, raw)
+	}
+}
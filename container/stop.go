@@ -1,57 +1,98 @@
 package container
 
 import (
-	"encoding/json"
-	"github.com/sirupsen/logrus"
-	"os"
-	"path/filepath"
+	"fmt"
 	"strconv"
 	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
 )
 
 // Stop 停止容器
 // 1. 找到pid
-// 2. 发送SIGTERM信号
-// 3. 修改config信息
-func Stop(containerId string) error {
-	pid, err := getPidById(containerId)
+// 2. 发送停止信号，默认为 SIGTERM
+// 3. 等待进程退出，超过 timeout 仍未退出则发送 SIGKILL
+// 4. 进程退出后再修改config信息
+func Stop(containerId string, sig syscall.Signal, timeout time.Duration) error {
+	info, err := getInfoById(containerId)
 	if err != nil {
-		logrus.Errorf("[Stop][id=%s] get pid error, %v", containerId, err)
+		logrus.Errorf("[Stop][id=%s] get info error, %v", containerId, err)
 		return err
 	}
+	if info.Status != RUNNING && info.Status != CREATED {
+		logrus.Infof("[%s] container is not running", containerId)
+		return nil
+	}
 
-	pidInt, err := strconv.Atoi(pid)
+	pid, err := strconv.Atoi(info.Pid)
 	if err != nil {
 		logrus.Errorf("[Stop][id=%s] atoi error, %v", containerId, err)
 		return err
 	}
 
-	// 杀死容器进程
-	if err = syscall.Kill(pidInt, syscall.SIGTERM); err != nil {
-		logrus.Errorf("[Stop][id=%s] kill pid = %d error, %v", containerId, pidInt, err)
+	// 先发送停止信号，容器作为 pid namespace 中的 1 号进程时可能会忽略 SIGTERM
+	if err = syscall.Kill(pid, sig); err != nil && err != syscall.ESRCH {
+		logrus.Errorf("[Stop][id=%s] kill pid = %d error, %v", containerId, pid, err)
+		return err
+	}
+	if !waitProcessExit(pid, timeout) {
+		logrus.Warnf("[%s] container did not exit in %s, kill it", containerId, timeout)
+		if err = syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			logrus.Errorf("[Stop][id=%s] kill pid = %d error, %v", containerId, pid, err)
+			return err
+		}
+		if !waitProcessExit(pid, killWaitTimeout) {
+			return fmt.Errorf("container %s did not exit after SIGKILL", containerId)
+		}
+	}
+
+	// 进程已经退出，修改容器信息，覆盖之前的数据
+	if err = UpdateInfo(containerId, func(info *Info) error {
+		info.Status = STOP
+		info.Pid = ""
+		return nil
+	}); err != nil {
+		logrus.Errorf("[Stop][id=%s] update info error, %v", containerId, err)
+		return err
 	}
+	logrus.Infof("[%s] stop container success", containerId)
+	return nil
+}
 
+// Kill 向运行中的容器发送信号，容器退出后由 monitor 记录退出状态
+func Kill(containerId string, sig syscall.Signal) error {
 	info, err := getInfoById(containerId)
 	if err != nil {
-		logrus.Errorf("[Stop][id=%s] get info error, %v", containerId, err)
+		logrus.Errorf("[Kill][id=%s] get info error, %v", containerId, err)
 		return err
 	}
-
-	// 修改容器信息
-	info.Status = STOP
-	info.Pid = " "
-	infoByte, err := json.Marshal(info)
+	if info.Status != RUNNING {
+		return fmt.Errorf("container %s is not running", containerId)
+	}
+	pid, err := strconv.Atoi(info.Pid)
 	if err != nil {
-		logrus.Errorf("[Stop][id=%s] to json string error, %v", containerId, err)
+		logrus.Errorf("[Kill][id=%s] atoi error, %v", containerId, err)
 		return err
 	}
-
-	// 覆盖之前的数据
-	configFilePath := filepath.Join(getContainerDir(containerId), ConfigName)
-	if err = os.WriteFile(configFilePath, infoByte, 0622); err != nil {
-		logrus.Errorf("[Stop][id=%s] write %s error, %v", containerId, configFilePath, err)
+	if err = syscall.Kill(pid, sig); err != nil {
+		logrus.Errorf("[Kill][id=%s] kill pid = %d error, %v", containerId, pid, err)
 		return err
 	}
-	logrus.Infof("[%s] stop container success", containerId)
 	return nil
 }
+
+// waitProcessExit 轮询等待进程退出，超时返回 false
+// 容器进程由 monitor 或者 run 进程 wait 回收，回收之后 kill(pid, 0) 返回 ESRCH
+func waitProcessExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := syscall.Kill(pid, 0); err == syscall.ESRCH {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
@@ -0,0 +1,117 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tmpfs 默认的挂载选项，与 docker 一致
+const defaultTmpfsFlags = syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
+
+// Tmpfs 挂载到容器中的 tmpfs
+type Tmpfs struct {
+	Destination string   `json:"destination"` // 容器内目录
+	Options     []string `json:"options"`     // 挂载选项，例如 size=64m、mode=1777、noexec
+}
+
+// ParseTmpfs 解析 --tmpfs 参数，格式为 path[:options]，options 以逗号分隔
+// 支持 size、mode、uid、gid、nr_inodes 以及 ro、rw、exec、noexec、suid、nosuid、dev、nodev
+func ParseTmpfs(raw string) (*Tmpfs, error) {
+	destination, options, _ := strings.Cut(raw, ":")
+	if !filepath.IsAbs(destination) {
+		return nil, fmt.Errorf("invaild tmpfs [%s], container path must be absolute", raw)
+	}
+	tmpfs := &Tmpfs{Destination: filepath.Clean(destination)}
+	if tmpfs.Destination == "/" {
+		return nil, fmt.Errorf("invaild tmpfs [%s], can not mount to /", raw)
+	}
+	if options != "" {
+		tmpfs.Options = strings.Split(options, ",")
+	}
+	if _, _, err := tmpfs.flagsAndData(); err != nil {
+		return nil, fmt.Errorf("invaild tmpfs [%s], %v", raw, err)
+	}
+	return tmpfs, nil
+}
+
+// ParseTmpfsList 解析多个 --tmpfs 参数，容器内目录不能重复
+func ParseTmpfsList(raws []string) ([]*Tmpfs, error) {
+	list := make([]*Tmpfs, 0, len(raws))
+	destinations := make(map[string]bool, len(raws))
+	for _, raw := range raws {
+		tmpfs, err := ParseTmpfs(raw)
+		if err != nil {
+			return nil, err
+		}
+		if destinations[tmpfs.Destination] {
+			return nil, fmt.Errorf("duplicate mount point %s", tmpfs.Destination)
+		}
+		destinations[tmpfs.Destination] = true
+		list = append(list, tmpfs)
+	}
+	return list, nil
+}
+
+// flagsAndData 把挂载选项转换为 mount 系统调用的 flags 和 data 参数
+func (t *Tmpfs) flagsAndData() (uintptr, string, error) {
+	flags := uintptr(defaultTmpfsFlags)
+	var data []string
+	for _, option := range t.Options {
+		key, value, hasValue := strings.Cut(option, "=")
+		switch key {
+		case "ro":
+			flags |= syscall.MS_RDONLY
+		case "rw":
+			flags &^= syscall.MS_RDONLY
+		case "exec":
+			flags &^= syscall.MS_NOEXEC
+		case "noexec":
+			flags |= syscall.MS_NOEXEC
+		case "suid":
+			flags &^= syscall.MS_NOSUID
+		case "nosuid":
+			flags |= syscall.MS_NOSUID
+		case "dev":
+			flags &^= syscall.MS_NODEV
+		case "nodev":
+			flags |= syscall.MS_NODEV
+		case "mode":
+			if _, err := strconv.ParseUint(value, 8, 32); err != nil {
+				return 0, "", fmt.Errorf("invalid mode %s", value)
+			}
+			data = append(data, option)
+		case "size", "uid", "gid", "nr_inodes", "nr_blocks":
+			if !hasValue || value == "" {
+				return 0, "", fmt.Errorf("option %s requires a value", key)
+			}
+			data = append(data, option)
+		default:
+			return 0, "", fmt.Errorf("unknown option %s", option)
+		}
+	}
+	return flags, strings.Join(data, ","), nil
+}
+
+// mountTmpfs 在容器的新根目录中挂载 tmpfs，需要在 pivot_root 之后执行
+func mountTmpfs(list []*Tmpfs) error {
+	for _, tmpfs := range list {
+		flags, data, err := tmpfs.flagsAndData()
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(tmpfs.Destination, 0755); err != nil {
+			return fmt.Errorf("mkdir %s error, %v", tmpfs.Destination, err)
+		}
+		if err = syscall.Mount("tmpfs", tmpfs.Destination, "tmpfs", flags, data); err != nil {
+			return fmt.Errorf("mount tmpfs to %s error, %v", tmpfs.Destination, err)
+		}
+		logrus.Infof("mount tmpfs to %s with options %s", tmpfs.Destination, data)
+	}
+	return nil
+}
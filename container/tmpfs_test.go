@@ -0,0 +1,36 @@
+package container
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTmpfs(t *testing.T) {
+	ast := assert.New(t)
+
+	tmpfs, err := ParseTmpfs("/run")
+	ast.Nil(err)
+	ast.Equal(&Tmpfs{Destination: "/run"}, tmpfs)
+	flags, data, err := tmpfs.flagsAndData()
+	ast.Nil(err)
+	ast.Equal(uintptr(defaultTmpfsFlags), flags)
+	ast.Equal("", data)
+
+	tmpfs, err = ParseTmpfs("/run/:size=64m,mode=1777,exec,ro")
+	ast.Nil(err)
+	ast.Equal("/run", tmpfs.Destination)
+	flags, data, err = tmpfs.flagsAndData()
+	ast.Nil(err)
+	ast.Equal(uintptr(syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_RDONLY), flags)
+	ast.Equal("size=64m,mode=1777", data)
+
+	for _, raw := range []string{"", "run", "/", "/run:size", "/run:mode=999", "/run:foo"} {
+		_, err = ParseTmpfs(raw)
+		ast.NotNil(err, raw)
+	}
+
+	_, err = ParseTmpfsList([]string{"/run", "/run/"})
+	ast.NotNil(err)
+}
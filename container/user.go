@@ -0,0 +1,111 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	passwdPath = "/etc/passwd"
+	groupPath  = "/etc/group"
+)
+
+// lookupUser 解析 -u 参数指定的用户，格式为 user[:group]，user 和 group 既可以是名字也可以是数字
+// 名字通过容器内的 /etc/passwd 和 /etc/group 查找，因此需要在 pivot_root 之后调用
+// 只指定 user 时使用该用户在 /etc/passwd 中的主组，找不到时为 0
+func lookupUser(spec string) (uid, gid int, err error) {
+	userPart, groupPart, hasGroup := strings.Cut(spec, ":")
+
+	var passwdFound bool
+	if uid, err = strconv.Atoi(userPart); err != nil {
+		uid, gid, passwdFound, err = findInFile(passwdPath, userPart, parsePasswdLine)
+		if err != nil {
+			return 0, 0, err
+		}
+		if !passwdFound {
+			return 0, 0, fmt.Errorf("unable to find user %s", userPart)
+		}
+	} else {
+		// 数字 uid 也尝试从 /etc/passwd 找到主组，找不到不算错误
+		_, gid, _, _ = findInFile(passwdPath, userPart, parsePasswdLine)
+	}
+
+	if !hasGroup {
+		return uid, gid, nil
+	}
+	if gid, err = strconv.Atoi(groupPart); err == nil {
+		return uid, gid, nil
+	}
+	_, gid, found, err := findInFile(groupPath, groupPart, parseGroupLine)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !found {
+		return 0, 0, fmt.Errorf("unable to find group %s", groupPart)
+	}
+	return uid, gid, nil
+}
+
+// findInFile 在 passwd/group 格式的文件中按名字或者 id 查找
+func findInFile(filePath, key string, parse func(line, key string) (int, int, bool)) (int, int, bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, false, nil
+		}
+		return 0, 0, false, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	id, gid, found := scanIdFile(file, key, parse)
+	return id, gid, found, nil
+}
+
+func scanIdFile(r io.Reader, key string, parse func(line, key string) (int, int, bool)) (int, int, bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if id, gid, ok := parse(line, key); ok {
+			return id, gid, true
+		}
+	}
+	return 0, 0, false
+}
+
+// parsePasswdLine 解析 /etc/passwd 的一行，格式为 name:password:uid:gid:gecos:home:shell
+func parsePasswdLine(line, key string) (int, int, bool) {
+	fields := strings.Split(line, ":")
+	if len(fields) < 4 || (fields[0] != key && fields[2] != key) {
+		return 0, 0, false
+	}
+	uid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return 0, 0, false
+	}
+	gid, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return 0, 0, false
+	}
+	return uid, gid, true
+}
+
+// parseGroupLine 解析 /etc/group 的一行，格式为 name:password:gid:members
+func parseGroupLine(line, key string) (int, int, bool) {
+	fields := strings.Split(line, ":")
+	if len(fields) < 3 || (fields[0] != key && fields[2] != key) {
+		return 0, 0, false
+	}
+	gid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return 0, 0, false
+	}
+	return gid, gid, true
+}
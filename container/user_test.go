@@ -0,0 +1,35 @@
+package container
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanIdFile(t *testing.T) {
+	ast := assert.New(t)
+
+	passwd := `root:x:0:0:root:/root:/bin/sh
+# comment
+nobody:x:65534:65534:nobody:/home:/bin/false
+www-data:x:33:33:www-data:/var/www:/bin/false
+`
+	uid, gid, found := scanIdFile(strings.NewReader(passwd), "www-data", parsePasswdLine)
+	ast.True(found)
+	ast.Equal(33, uid)
+	ast.Equal(33, gid)
+
+	uid, gid, found = scanIdFile(strings.NewReader(passwd), "65534", parsePasswdLine)
+	ast.True(found)
+	ast.Equal(65534, uid)
+	ast.Equal(65534, gid)
+
+	_, _, found = scanIdFile(strings.NewReader(passwd), "mysql", parsePasswdLine)
+	ast.False(found)
+
+	group := "root:x:0:\nwheel:x:10:root\n"
+	gid, _, found = scanIdFile(strings.NewReader(group), "wheel", parseGroupLine)
+	ast.True(found)
+	ast.Equal(10, gid)
+}
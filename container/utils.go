@@ -12,9 +12,12 @@ import (
 	"github.com/pjimming/mydocker/utils/jsonx"
 )
 
+// infoRoot 保存容器信息的根目录，测试时替换为临时目录
+var infoRoot = InfoLoc
+
 // getContainerDir 获取容器记录在宿主机上的dir
 func getContainerDir(containerId string) string {
-	return fmt.Sprintf(InfoLocFormat, containerId)
+	return filepath.Join(infoRoot, containerId) + "/"
 }
 
 // 根据containerId获取容器的pid
@@ -52,21 +55,10 @@ func getInfoById(id string) (*Info, error) {
 	return info, nil
 }
 
-func getImage(imageName string) string {
-	return RootUrl + imageName + ".tar"
-}
-func getUnTar(imageName string) string {
-	return RootUrl + imageName + "/"
-}
-
 func getRoot(containerId string) string {
 	return path.Join(RootUrl, containerId)
 }
 
-func getLower(containerId string) string {
-	return fmt.Sprintf(lowerDirFormat, containerId)
-}
-
 func getUpper(containerId string) string {
 	return fmt.Sprintf(upperDirFormat, containerId)
 }
@@ -79,10 +71,11 @@ func getMerged(containerId string) string {
 	return fmt.Sprintf(mergedDirFormat, containerId)
 }
 
-func getOverlayFsDirs(containerId string) string {
+// getOverlayFsDirs 拼接 overlay 的挂载参数，lowerDirs 需要按照从顶层到底层的顺序排列
+func getOverlayFsDirs(containerId string, lowerDirs []string) string {
 	// lowerdir=lower1:lower2:lower3,upperdir=upper,workdir=work
 	return fmt.Sprintf(overlayFSFormat,
-		getLower(containerId),
+		strings.Join(lowerDirs, ":"),
 		getUpper(containerId),
 		getWorker(containerId),
 	)
@@ -1,14 +1,15 @@
 package container
 
 import (
+	"bufio"
 	"fmt"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 )
 
 /*
@@ -17,53 +18,98 @@ import (
 
 // NewWorkSpace create an overlays filesystem as container root workspace
 /*
-1）创建lower层
+1）镜像的层已经解压在镜像存储中，直接作为只读的lower层
 2）创建upper、worker层
 3）创建merged目录并挂载overlayFS
-4）如果有指定volume则挂载volume
+4）如果有指定volume则按顺序挂载volume
 */
-func NewWorkSpace(volume, imageName, containerId string) error {
-	if err := createLower(imageName, containerId); err != nil {
-		logrus.Errorf("[NewWorkSpace][image:%s][containerId:%s] create lower error, %v", imageName, containerId, err)
-		return err
-	}
+func NewWorkSpace(volumes []*Volume, lowerDirs []string, containerId string) error {
 	if err := createUpperAndWorker(containerId); err != nil {
 		logrus.Errorf("[NewWorkSpace][containerId:%s] create upper and worker error, %v", containerId, err)
 		return err
 	}
-	if err := mountOverlayFs(containerId); err != nil {
+	if err := mountOverlayFs(containerId, lowerDirs); err != nil {
 		logrus.Errorf("[NewWorkSpace][containerId:%s] mount overlayFs error, %v", containerId, err)
 		return err
 	}
 
-	if volume != "" {
-		hostPath, containerPath, err := volumeExtract(volume)
-		if err != nil {
-			logrus.Errorf("volume extract fail: %v", err)
+	for _, volume := range volumes {
+		if err := mountVolume(containerId, volume); err != nil {
+			logrus.Errorf("[NewWorkSpace][ContainerId:%s] mount volume %s error, %v", containerId, volume, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// MountWorkSpace 重新挂载已经存在的容器工作目录，用于启动已经停止的容器
+// 容器停止后 overlayFs 和 volume 一般仍然处于挂载状态，宿主机重启后挂载点会丢失，这里只挂载缺失的部分
+func MountWorkSpace(volumes []*Volume, lowerDirs []string, containerId string) error {
+	mntPath := getMerged(containerId)
+	mounted, err := isMountPoint(mntPath)
+	if err != nil {
+		return err
+	}
+	if !mounted {
+		if err = mountOverlayFs(containerId, lowerDirs); err != nil {
+			logrus.Errorf("[MountWorkSpace][containerId:%s] mount overlayFs error, %v", containerId, err)
+			return err
+		}
+	}
+
+	for _, volume := range volumes {
+		if mounted, err = isMountPoint(filepath.Join(mntPath, volume.Destination)); err != nil {
 			return err
 		}
-		if err = mountVolume(containerId, hostPath, containerPath); err != nil {
-			logrus.Errorf("[NewWorkSpace][ContainerId:%s] mount volume error, %v", containerId, err)
+		if mounted {
+			continue
+		}
+		if err = mountVolume(containerId, volume); err != nil {
+			logrus.Errorf("[MountWorkSpace][containerId:%s] mount volume %s error, %v", containerId, volume, err)
 			return err
 		}
 	}
 	return nil
 }
 
-// createLower 把busybox作为overlays的lower层
-func createLower(imageName, containerId string) error {
-	imagePath := getImage(imageName)
-	lower := getLower(containerId)
+// isMountPoint 通过 /proc/self/mountinfo 判断目录是否是挂载点
+func isMountPoint(dir string) (bool, error) {
+	mountPoints, err := readMountPoints()
+	if err != nil {
+		return false, err
+	}
+	dir = filepath.Clean(dir)
+	for _, mountPoint := range mountPoints {
+		if mountPoint == dir {
+			return true, nil
+		}
+	}
+	return false, nil
+}
 
-	if err := os.MkdirAll(lower, 0622); err != nil {
-		logrus.Errorf("mkdir all %s error, %v", lower, err)
-		return err
+// mountInfoUnescaper mountinfo 中的路径会把空格等字符转义成八进制
+var mountInfoUnescaper = strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, "\\")
+
+// readMountPoints 读取当前 mount namespace 中的所有挂载点
+func readMountPoints() ([]string, error) {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
 	}
-	if _, err := exec.Command("tar", "-xvf", imagePath, "-C", lower).CombinedOutput(); err != nil {
-		logrus.Errorf("[createLower][tar -xvf %s -C %s] error, %v", imagePath, lower, err)
-		return err
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var mountPoints []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// 第五个字段是挂载点，例如 104 85 0:20 / /root/1234567890/merged rw,relatime - overlay overlay rw,...
+		fields := strings.Split(scanner.Text(), " ")
+		if len(fields) > 4 {
+			mountPoints = append(mountPoints, mountInfoUnescaper.Replace(fields[4]))
+		}
 	}
-	return nil
+	return mountPoints, scanner.Err()
 }
 
 // createUpperAndWorker 创建overlay fs需要的的upper、worker目录
@@ -81,7 +127,10 @@ func createUpperAndWorker(containerId string) error {
 	return nil
 }
 
-func mountOverlayFs(containerId string) error {
+func mountOverlayFs(containerId string, lowerDirs []string) error {
+	if len(lowerDirs) == 0 {
+		return fmt.Errorf("image has no layers")
+	}
 	// mount -t overlay overlay -o lowerdir=lower1:lower2:lower3,upperdir=upper,workdir=work merged
 	// 创建对应的挂载路径
 	mntPath := getMerged(containerId)
@@ -90,53 +139,54 @@ func mountOverlayFs(containerId string) error {
 		return err
 	}
 	// 拼接参数
-	// lowerdir=/root/busybox,upperdir=/root/upper,workdir=/root/merged
-	cmd := exec.Command("mount", "-t", "overlay", "overlay", "-o", getOverlayFsDirs(containerId), mntPath)
-	logrus.Infof(cmd.String())
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		logrus.Errorf("mount overlay fail, %v", err)
-		return err
-	}
-	return nil
+	// lowerdir=/var/lib/mydocker/image/layers/sha256/{top}/diff:...,upperdir=/root/{containerId}/upper,workdir=/root/{containerId}/work
+	return mountOverlay(mntPath, 0, getOverlayFsDirs(containerId, lowerDirs))
 }
 
-func volumeExtract(volume string) (sourcePath, destinationPath string, err error) {
-	parts := strings.Split(volume, ":")
-	if len(parts) != 2 {
-		return "", "", fmt.Errorf("invaild volume [%s]", volume)
+// mountOverlay 挂载 overlayFs，相当于 mount -t overlay overlay -o {data} {target}
+func mountOverlay(target string, flags uintptr, data string) error {
+	// 挂载选项最多只能有一个内存页，层数过多时内核会直接返回 EINVAL，这里提前给出明确的错误
+	if len(data) >= os.Getpagesize() {
+		return &os.PathError{Op: "mount overlay", Path: target,
+			Err: fmt.Errorf("mount options too long (%d bytes), image has too many layers", len(data))}
 	}
-
-	sourcePath, destinationPath = parts[0], parts[1]
-	if sourcePath == "" || destinationPath == "" {
-		return "", "", fmt.Errorf("invaild volume [%s]", volume)
+	logrus.Infof("mount -t overlay overlay -o %s %s", data, target)
+	if err := unix.Mount("overlay", target, "overlay", flags, data); err != nil {
+		return &os.PathError{Op: "mount overlay", Path: target, Err: err}
 	}
-	return
+	return nil
 }
 
-// 使用 bind mount 挂载 volume
-func mountVolume(containerId, hostPath, containerPath string) error {
+// 使用 bind mount 挂载 volume，再根据选项设置只读和挂载传播类型
+func mountVolume(containerId string, volume *Volume) error {
 	// 宿主机目录
-	if err := os.MkdirAll(hostPath, 0777); err != nil {
-		logrus.Errorf("[mountVolume] mkdir %s fail, %v", hostPath, err)
+	if err := os.MkdirAll(volume.Source, 0777); err != nil {
+		logrus.Errorf("[mountVolume] mkdir %s fail, %v", volume.Source, err)
 		return err
 	}
 	// 容器目录
 	mntPath := getMerged(containerId)
-	containerVolumePath := filepath.Join(mntPath, containerPath)
+	containerVolumePath := filepath.Join(mntPath, volume.Destination)
 	if err := os.MkdirAll(containerVolumePath, 0777); err != nil {
 		logrus.Errorf("[mountVolume] mkdir %s fail, %v", containerVolumePath, err)
 		return err
 	}
 	// 通过bind mount 将宿主机目录挂载到容器目录
 	// mount -o bind /hostPath /containerVolumePath
-	cmd := exec.Command("mount", "-o", "bind", hostPath, containerVolumePath)
-
-	logrus.Infof("[mountVolume] cmd = %s", cmd.String())
-	if _, err := cmd.CombinedOutput(); err != nil {
-		logrus.Errorf("mount volume failed. %v", err)
-		return err
+	logrus.Infof("[mountVolume] bind mount %s to %s", volume.Source, containerVolumePath)
+	if err := unix.Mount(volume.Source, containerVolumePath, "bind", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return &os.PathError{Op: "bind mount " + volume.Source, Path: containerVolumePath, Err: err}
+	}
+	// bind mount 时会忽略 MS_RDONLY，只读需要再 remount 一次
+	if volume.ReadOnly {
+		if err := unix.Mount("", containerVolumePath, "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY, ""); err != nil {
+			_ = unix.Unmount(containerVolumePath, unix.MNT_DETACH)
+			return &os.PathError{Op: "remount read only", Path: containerVolumePath, Err: err}
+		}
+	}
+	if err := unix.Mount("", containerVolumePath, "", volume.propagationFlag(), ""); err != nil {
+		_ = unix.Unmount(containerVolumePath, unix.MNT_DETACH)
+		return &os.PathError{Op: "set propagation " + volume.Propagation, Path: containerVolumePath, Err: err}
 	}
 	return nil
 }
@@ -144,28 +194,15 @@ func mountVolume(containerId, hostPath, containerPath string) error {
 // DeleteWorkSpace 删除overlayFs当容器退出
 /*
 和创建相反
-1）有volume则卸载volume
+1）有volume则按挂载的逆序卸载volume
 2）卸载merged目录
 3）卸载upper、worker层
 4）移除该容器的overlayFs目录
 */
-func DeleteWorkSpace(volume, containerId string) error {
-	logrus.Infof("[DeleteWorkSpace] volume:%s; containerId:%s", volume, containerId)
-	// 1. umount volume
-	if volume != "" {
-		_, containerPath, err := volumeExtract(volume)
-		if err != nil {
-			logrus.Errorf("[DeleteWorkSpace] volume %s extract fail, %v", volume, err)
-			return err
-		}
-		if err = umountVolume(containerId, containerPath); err != nil {
-			logrus.Errorf("[DeleteWorkSpace] umount volume fail, %v", err)
-			return err
-		}
-	}
-
-	if err := umountOverlayFs(containerId); err != nil {
-		logrus.Errorf("[DeleteWorkSpace] umount overlayFs error, %v", err)
+func DeleteWorkSpace(volumes []*Volume, containerId string) error {
+	logrus.Infof("[DeleteWorkSpace] volumes:%v; containerId:%s", volumes, containerId)
+	if err := UmountWorkSpace(volumes, containerId); err != nil {
+		logrus.Errorf("[DeleteWorkSpace] umount workspace error, %v", err)
 		return err
 	}
 	if err := deleteDirs(containerId); err != nil {
@@ -175,31 +212,45 @@ func DeleteWorkSpace(volume, containerId string) error {
 	return nil
 }
 
+// UmountWorkSpace 卸载容器的 volume 和 overlayFs，保留容器的目录，已经卸载的部分直接跳过
+// 启动已经停止的容器失败时用于撤销 MountWorkSpace 的挂载
+func UmountWorkSpace(volumes []*Volume, containerId string) error {
+	// 后挂载的 volume 可能在先挂载的 volume 里面，需要逆序卸载
+	for i := len(volumes) - 1; i >= 0; i-- {
+		if err := umountVolume(containerId, volumes[i].Destination); err != nil {
+			return err
+		}
+	}
+	return umountOverlayFs(containerId)
+}
+
 func umountVolume(containerId, containerPath string) error {
 	// mntPath 为容器在宿主机上的挂载点，例如 /root/merged
 	// containerPath 为 volume 在容器中对应的目录，例如 /root/tmp
 	// containerPathInHost 则是容器中目录在宿主机上的具体位置，例如 /root/{containerId}/merged/root/tmp
 	containerPathInHost := path.Join(getMerged(containerId), containerPath)
-	cmd := exec.Command("umount", containerPathInHost)
-
-	logrus.Infof("[umountVolume] cmd = %s", cmd.String())
-	if _, err := cmd.CombinedOutput(); err != nil {
-		logrus.Errorf("umount volume failed. %v", err)
+	mounted, err := isMountPoint(containerPathInHost)
+	if err != nil || !mounted {
 		return err
 	}
+	logrus.Infof("[umountVolume] umount %s", containerPathInHost)
+	if err = unix.Unmount(containerPathInHost, 0); err != nil {
+		return &os.PathError{Op: "umount volume", Path: containerPathInHost, Err: err}
+	}
 	logrus.Infof("umount volume %s success", containerPathInHost)
 	return nil
 }
 
 func umountOverlayFs(containerId string) error {
 	mntPath := getMerged(containerId)
-	cmd := exec.Command("umount", mntPath)
-
-	logrus.Info(cmd.String())
-	if _, err := cmd.CombinedOutput(); err != nil {
-		logrus.Errorf("umount command run fail, %v", err)
+	mounted, err := isMountPoint(mntPath)
+	if err != nil || !mounted {
 		return err
 	}
+	logrus.Infof("umount %s", mntPath)
+	if err = unix.Unmount(mntPath, 0); err != nil {
+		return &os.PathError{Op: "umount overlay", Path: mntPath, Err: err}
+	}
 	logrus.Infof("umount overlayFs %s success", mntPath)
 	return nil
 }
@@ -0,0 +1,129 @@
+package container
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// volume 的挂载传播类型
+const (
+	PropagationRPrivate = "rprivate"
+	PropagationRSlave   = "rslave"
+	PropagationRShared  = "rshared"
+)
+
+// Volume 容器挂载的数据卷
+type Volume struct {
+	Name        string `json:"name"`        // 命名数据卷或匿名数据卷的名字，直接挂载宿主机目录时为空
+	Anonymous   bool   `json:"anonymous"`   // 是否是匿名数据卷
+	Source      string `json:"source"`      // 宿主机目录
+	Destination string `json:"destination"` // 容器内目录
+	ReadOnly    bool   `json:"readOnly"`    // 是否只读
+	Propagation string `json:"propagation"` // 挂载传播类型，rprivate、rslave 或 rshared
+}
+
+func (v *Volume) String() string {
+	mode := "rw"
+	if v.ReadOnly {
+		mode = "ro"
+	}
+	source := v.Source
+	if v.Name != "" {
+		source = v.Name
+	}
+	return fmt.Sprintf("%s:%s:%s,%s", source, v.Destination, mode, v.Propagation)
+}
+
+// propagationFlag 获取挂载传播类型对应的 mount flag
+func (v *Volume) propagationFlag() uintptr {
+	switch v.Propagation {
+	case PropagationRShared:
+		return syscall.MS_SHARED | syscall.MS_REC
+	case PropagationRSlave:
+		return syscall.MS_SLAVE | syscall.MS_REC
+	default:
+		return syscall.MS_PRIVATE | syscall.MS_REC
+	}
+}
+
+// IsManaged 是否是由 mydocker volume 管理的数据卷
+func (v *Volume) IsManaged() bool {
+	return v.Name != "" || v.Anonymous
+}
+
+// ParseVolume 解析 -v 参数，格式为 [host|name:]container[:ro|rw][,rshared|rslave|rprivate]
+// 例如 /data:/data、/data:/data:ro、/data:/data:ro,rslave、/data:/data:rshared
+// 不是绝对路径的 host 表示命名数据卷，例如 data:/var/lib/app；只有容器目录时表示匿名数据卷，例如 /var/lib/app
+func ParseVolume(raw string) (*Volume, error) {
+	parts := strings.Split(raw, ":")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invaild volume [%s]", raw)
+	}
+	volume := &Volume{Propagation: PropagationRPrivate}
+	if len(parts) == 1 {
+		volume.Anonymous = true
+		volume.Destination = parts[0]
+	} else {
+		volume.Source, volume.Destination = parts[0], parts[1]
+		if volume.Source == "" {
+			return nil, fmt.Errorf("invaild volume [%s]", raw)
+		}
+		if !filepath.IsAbs(volume.Source) {
+			volume.Name, volume.Source = volume.Source, ""
+		}
+	}
+	if volume.Destination == "" {
+		return nil, fmt.Errorf("invaild volume [%s]", raw)
+	}
+	if !filepath.IsAbs(volume.Destination) {
+		return nil, fmt.Errorf("invaild volume [%s], container path must be absolute", raw)
+	}
+	volume.Destination = filepath.Clean(volume.Destination)
+	if volume.Destination == "/" {
+		return nil, fmt.Errorf("invaild volume [%s], can not mount to /", raw)
+	}
+	if len(parts) < 3 {
+		return volume, nil
+	}
+
+	var modeSet, propagationSet bool
+	for _, option := range strings.Split(parts[2], ",") {
+		switch option {
+		case "ro", "rw":
+			if modeSet {
+				return nil, fmt.Errorf("invaild volume [%s], duplicate mode option", raw)
+			}
+			modeSet = true
+			volume.ReadOnly = option == "ro"
+		case PropagationRPrivate, PropagationRSlave, PropagationRShared:
+			if propagationSet {
+				return nil, fmt.Errorf("invaild volume [%s], duplicate propagation option", raw)
+			}
+			propagationSet = true
+			volume.Propagation = option
+		default:
+			return nil, fmt.Errorf("invaild volume [%s], unknown option %s", raw, option)
+		}
+	}
+	return volume, nil
+}
+
+// ParseVolumes 解析多个 -v 参数，容器内目录不能重复
+func ParseVolumes(raws []string) ([]*Volume, error) {
+	volumes := make([]*Volume, 0, len(raws))
+	destinations := make(map[string]bool, len(raws))
+	for _, raw := range raws {
+		volume, err := ParseVolume(raw)
+		if err != nil {
+			return nil, err
+		}
+		if destinations[volume.Destination] {
+			return nil, fmt.Errorf("duplicate mount point %s", volume.Destination)
+		}
+		destinations[volume.Destination] = true
+		volumes = append(volumes, volume)
+	}
+	return volumes, nil
+}
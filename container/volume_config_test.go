@@ -0,0 +1,65 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVolume(t *testing.T) {
+	ast := assert.New(t)
+
+	volume, err := ParseVolume("/data:/data")
+	ast.Nil(err)
+	ast.Equal(&Volume{Source: "/data", Destination: "/data", Propagation: PropagationRPrivate}, volume)
+
+	volume, err = ParseVolume("/data:/app/data/:ro")
+	ast.Nil(err)
+	ast.Equal(&Volume{Source: "/data", Destination: "/app/data", ReadOnly: true, Propagation: PropagationRPrivate}, volume)
+
+	volume, err = ParseVolume("/data:/data:rw,rslave")
+	ast.Nil(err)
+	ast.Equal(&Volume{Source: "/data", Destination: "/data", Propagation: PropagationRSlave}, volume)
+
+	volume, err = ParseVolume("/data:/data:rshared")
+	ast.Nil(err)
+	ast.Equal(&Volume{Source: "/data", Destination: "/data", Propagation: PropagationRShared}, volume)
+	ast.False(volume.IsManaged())
+
+	volume, err = ParseVolume("data:/var/lib/app:ro")
+	ast.Nil(err)
+	ast.Equal(&Volume{Name: "data", Destination: "/var/lib/app", ReadOnly: true, Propagation: PropagationRPrivate}, volume)
+	ast.True(volume.IsManaged())
+
+	volume, err = ParseVolume("/var/lib/app")
+	ast.Nil(err)
+	ast.Equal(&Volume{Anonymous: true, Destination: "/var/lib/app", Propagation: PropagationRPrivate}, volume)
+	ast.True(volume.IsManaged())
+
+	for _, raw := range []string{
+		"",
+		"data",
+		":/data",
+		"/data:",
+		"/data:data",
+		"/data:/",
+		"/data:/data:rx",
+		"/data:/data:ro,rw",
+		"/data:/data:rshared,rslave",
+		"/data:/data:ro:rshared",
+	} {
+		_, err = ParseVolume(raw)
+		ast.NotNil(err, raw)
+	}
+}
+
+func TestParseVolumes(t *testing.T) {
+	ast := assert.New(t)
+
+	volumes, err := ParseVolumes([]string{"/a:/a", "/b:/a/b:ro"})
+	ast.Nil(err)
+	ast.Len(volumes, 2)
+
+	_, err = ParseVolumes([]string{"/a:/data", "/b:/data/"})
+	ast.NotNil(err)
+}
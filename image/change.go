@@ -0,0 +1,130 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ApplyChanges 把 Dockerfile 格式的指令应用到镜像配置上，用于 commit --change
+// 支持 CMD、ENTRYPOINT、ENV、WORKDIR、USER 和 LABEL
+func ApplyChanges(cfg *ContainerConfig, changes []string) error {
+	for _, change := range changes {
+		instruction, value, _ := strings.Cut(strings.TrimSpace(change), " ")
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return fmt.Errorf("%s requires at least one argument", change)
+		}
+		switch strings.ToUpper(instruction) {
+		case "CMD":
+			cfg.Cmd = parseCommand(value)
+		case "ENTRYPOINT":
+			cfg.Entrypoint = parseCommand(value)
+		case "ENV":
+			pairs, err := parseKeyValues(value)
+			if err != nil {
+				return fmt.Errorf("invalid change %q, %v", change, err)
+			}
+			for _, pair := range pairs {
+				cfg.Env = MergeEnv(cfg.Env, []string{pair[0] + "=" + pair[1]})
+			}
+		case "LABEL":
+			pairs, err := parseKeyValues(value)
+			if err != nil {
+				return fmt.Errorf("invalid change %q, %v", change, err)
+			}
+			if cfg.Labels == nil {
+				cfg.Labels = make(map[string]string)
+			}
+			for _, pair := range pairs {
+				cfg.Labels[pair[0]] = pair[1]
+			}
+		case "WORKDIR":
+			if !strings.HasPrefix(value, "/") {
+				// 相对路径相对于之前的工作目录
+				value = strings.TrimSuffix(cfg.WorkingDir, "/") + "/" + value
+			}
+			cfg.WorkingDir = value
+		case "USER":
+			cfg.User = value
+		default:
+			return fmt.Errorf("unsupported change instruction %s", instruction)
+		}
+	}
+	return nil
+}
+
+// parseCommand 解析 json 数组格式的命令，其他格式按照 shell 格式交给 /bin/sh -c 执行
+func parseCommand(value string) []string {
+	var command []string
+	if strings.HasPrefix(value, "[") && json.Unmarshal([]byte(value), &command) == nil {
+		return command
+	}
+	return []string{"/bin/sh", "-c", value}
+}
+
+// parseKeyValues 解析 key=value key2="value 2" 格式，或者只有一对的 key value 格式
+func parseKeyValues(value string) ([][2]string, error) {
+	words, err := splitWords(value)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(words[0], "=") {
+		key, rest, _ := strings.Cut(value, " ")
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return nil, fmt.Errorf("missing value for %s", key)
+		}
+		return [][2]string{{key, rest}}, nil
+	}
+	pairs := make([][2]string, 0, len(words))
+	for _, word := range words {
+		key, val, found := strings.Cut(word, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("%s must be key=value", word)
+		}
+		pairs = append(pairs, [2]string{key, val})
+	}
+	return pairs, nil
+}
+
+// splitWords 按空白分割，支持单双引号和反斜杠转义
+func splitWords(value string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	var quote rune
+	inWord, escaped := false, false
+	for _, c := range value {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", value)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,98 @@
+package image
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"time"
+)
+
+// CommitOptions 提交镜像的参数
+type CommitOptions struct {
+	Ref       string           // 新镜像的镜像名，为空时不设置
+	Author    string           // 镜像作者
+	Comment   string           // 提交说明
+	CreatedBy string           // 生成这一层的命令
+	Config    *ContainerConfig // 镜像中保存的容器默认运行参数，为 nil 时继承父镜像
+}
+
+// Commit 把容器的改动作为新的一层叠加到父镜像的层之上，生成新的镜像并返回镜像Id
+// diff 为 OCI 格式的层，parentId 为空时新镜像只有这一层
+// 容器没有改动时不增加新的层，只记录一条 EmptyLayer 的历史，和 docker 一致
+func Commit(parentId string, diff io.Reader, opts *CommitOptions) (string, error) {
+	if opts.Ref != "" {
+		if _, err := NormalizeReference(opts.Ref); err != nil {
+			return "", err
+		}
+	}
+	cfg := &Config{
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+		RootFS:       RootFS{Type: "layers"},
+	}
+	if parentId != "" {
+		parent, err := Get(parentId)
+		if err != nil {
+			return "", fmt.Errorf("get parent image %s error, %v", parentId, err)
+		}
+		cfg = parent.Config
+	}
+	if opts.Config != nil {
+		cfg.Config = *opts.Config
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	history := History{
+		Created:   now,
+		CreatedBy: opts.CreatedBy,
+		Author:    opts.Author,
+		Comment:   opts.Comment,
+	}
+	buffered := bufio.NewReaderSize(diff, emptyTarSize)
+	if parentId != "" && isEmptyTar(buffered) {
+		history.EmptyLayer = true
+	} else {
+		layer, err := ApplyLayer(buffered)
+		if err != nil {
+			return "", err
+		}
+		cfg.RootFS.DiffIds = append(cfg.RootFS.DiffIds, layer.DiffId)
+	}
+	cfg.Created = now
+	cfg.Author = opts.Author
+	cfg.History = append(cfg.History, history)
+
+	config, err := json.Marshal(cfg)
+	if err != nil {
+		return "", err
+	}
+	imageId, err := Create(config)
+	if err != nil {
+		return "", err
+	}
+	if opts.Ref != "" {
+		if err = Tag(opts.Ref, imageId); err != nil {
+			return "", err
+		}
+	}
+	return imageId, nil
+}
+
+// emptyTarSize 空 tar 只有两个 512 字节的全零块作为结束标记
+const emptyTarSize = 1024
+
+// isEmptyTar 判断层中是否没有任何文件，只查看开头的数据，不消耗 r
+func isEmptyTar(r *bufio.Reader) bool {
+	head, err := r.Peek(emptyTarSize)
+	if err != nil && err != io.EOF {
+		return false
+	}
+	for _, b := range head {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
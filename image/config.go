@@ -0,0 +1,34 @@
+package image
+
+import "strings"
+
+// Command 按照 docker 的规则生成容器的启动命令
+// entrypoint 为 nil 时使用镜像的 Entrypoint，否则忽略镜像的 Entrypoint 和 Cmd；
+// args 为空时使用镜像的 Cmd 作为 Entrypoint 的参数
+func (c *ContainerConfig) Command(entrypoint, args []string) []string {
+	if entrypoint == nil {
+		entrypoint = c.Entrypoint
+		if len(args) == 0 {
+			args = c.Cmd
+		}
+	}
+	command := make([]string, 0, len(entrypoint)+len(args))
+	command = append(command, entrypoint...)
+	return append(command, args...)
+}
+
+// MergeEnv 合并环境变量，overrides 中同名的变量覆盖 base 中的变量，保持变量第一次出现的顺序
+func MergeEnv(base, overrides []string) []string {
+	merged := make([]string, 0, len(base)+len(overrides))
+	index := make(map[string]int)
+	for _, env := range append(append([]string{}, base...), overrides...) {
+		key, _, _ := strings.Cut(env, "=")
+		if i, ok := index[key]; ok {
+			merged[i] = env
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, env)
+	}
+	return merged
+}
@@ -0,0 +1,51 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand(t *testing.T) {
+	ast := assert.New(t)
+	cfg := &ContainerConfig{Entrypoint: []string{"/entry.sh"}, Cmd: []string{"nginx", "-g", "daemon off;"}}
+	ast.Equal([]string{"/entry.sh", "nginx", "-g", "daemon off;"}, cfg.Command(nil, nil))
+	ast.Equal([]string{"/entry.sh", "sh"}, cfg.Command(nil, []string{"sh"}))
+	// 指定 entrypoint 时不再使用镜像的 Cmd
+	ast.Equal([]string{"top"}, cfg.Command([]string{"top"}, nil))
+	ast.Equal([]string{"top", "-b"}, cfg.Command([]string{"top"}, []string{"-b"}))
+	ast.Empty(cfg.Command([]string{}, nil))
+	ast.Equal([]string{"ls"}, (&ContainerConfig{}).Command(nil, []string{"ls"}))
+}
+
+func TestMergeEnv(t *testing.T) {
+	ast := assert.New(t)
+	ast.Equal([]string{"PATH=/usr/bin", "A=2", "B"},
+		MergeEnv([]string{"PATH=/bin", "A=1"}, []string{"A=2", "PATH=/usr/bin", "B"}))
+	ast.Empty(MergeEnv(nil, nil))
+}
+
+func TestApplyChanges(t *testing.T) {
+	ast := assert.New(t)
+	cfg := &ContainerConfig{Env: []string{"PATH=/bin"}, WorkingDir: "/app"}
+	ast.Nil(ApplyChanges(cfg, []string{
+		`CMD ["nginx", "-g", "daemon off;"]`,
+		`ENTRYPOINT /docker-entrypoint.sh --verbose`,
+		`ENV PATH=/usr/bin:/bin GREETING="hello world"`,
+		`ENV NAME mydocker box`,
+		`workdir src`,
+		`USER nobody:nogroup`,
+		`LABEL version=1.0`,
+	}))
+	ast.Equal([]string{"nginx", "-g", "daemon off;"}, cfg.Cmd)
+	ast.Equal([]string{"/bin/sh", "-c", "/docker-entrypoint.sh --verbose"}, cfg.Entrypoint)
+	ast.Equal([]string{"PATH=/usr/bin:/bin", "GREETING=hello world", "NAME=mydocker box"}, cfg.Env)
+	ast.Equal("/app/src", cfg.WorkingDir)
+	ast.Equal("nobody:nogroup", cfg.User)
+	ast.Equal(map[string]string{"version": "1.0"}, cfg.Labels)
+
+	ast.NotNil(ApplyChanges(cfg, []string{"RUN ls"}))
+	ast.NotNil(ApplyChanges(cfg, []string{"CMD"}))
+	ast.NotNil(ApplyChanges(cfg, []string{`ENV A="b`}))
+	ast.NotNil(ApplyChanges(cfg, []string{"ENV A"}))
+}
@@ -0,0 +1,37 @@
+package image
+
+import "github.com/pjimming/mydocker/container"
+
+const (
+	// EnvImageRoot 修改镜像存储根目录的环境变量
+	EnvImageRoot = "MYDOCKER_IMAGE_ROOT"
+	// DefaultRoot 默认的镜像存储根目录
+	DefaultRoot = "/var/lib/mydocker/image/"
+	// DefaultTag 镜像引用没有指定 tag 时使用的 tag
+	DefaultTag = "latest"
+	// digestAlgorithm 镜像和层的摘要算法
+	digestAlgorithm = "sha256"
+	// legacyImageDir 旧版本把镜像保存为 /root/{imageName}.tar
+	legacyImageDir = container.RootUrl
+)
+
+// 镜像存储目录结构：
+//
+//	{root}/layers/sha256/{hex}/diff        解压后的层，作为 overlay 的 lowerdir
+//	{root}/layers/sha256/{hex}/layer.json  层的元数据
+//	{root}/imagedb/content/sha256/{hex}    镜像配置，镜像Id即配置的摘要
+//	{root}/imagedb/metadata/sha256/{hex}   镜像的元数据，记录引用该镜像的容器
+//	{root}/repositories.json               镜像名到镜像Id的索引
+//	{root}/tmp/                            层解压的临时目录
+//	{root}/downloads/{hex}[.partial]       从 registry 下载的层，未完成时带 .partial 后缀
+const (
+	layersDir        = "layers"
+	layerDiffDir     = "diff"
+	layerConfigName  = "layer.json"
+	imageContentDir  = "imagedb/content"
+	imageMetadataDir = "imagedb/metadata"
+	repositoriesName = "repositories.json"
+	tmpDir           = "tmp"
+	downloadsDir     = "downloads"
+	lockName         = "store.lock"
+)
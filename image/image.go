@@ -0,0 +1,379 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/pjimming/mydocker/container"
+)
+
+// containerExists 判断容器是否还存在，用于忽略已经被删除的容器留下的引用
+var containerExists = func(containerId string) bool {
+	_, err := os.Stat(filepath.Join(container.InfoLoc, containerId, container.ConfigName))
+	return err == nil
+}
+
+// containerLayers 获取仍然存在的容器作为 lowerdir 使用的层目录
+// 镜像被强制删除后容器仍然依赖镜像的层，和其他镜像共享的层也不能被删除
+var containerLayers = func() (map[string]bool, error) {
+	infos, err := container.ListInfos()
+	if err != nil {
+		return nil, err
+	}
+	dirs := make(map[string]bool)
+	for _, info := range infos {
+		for _, dir := range info.LowerDirs {
+			dirs[dir] = true
+		}
+	}
+	return dirs, nil
+}
+
+// Config OCI 镜像配置，镜像Id就是配置内容的摘要
+type Config struct {
+	Created      string          `json:"created,omitempty"` // 镜像创建时间，RFC3339 格式
+	Author       string          `json:"author,omitempty"`  // 镜像作者
+	Architecture string          `json:"architecture"`      // CPU 架构
+	OS           string          `json:"os"`                // 操作系统
+	Config       ContainerConfig `json:"config"`            // 容器运行的默认参数
+	RootFS       RootFS          `json:"rootfs"`            // 镜像的层
+	History      []History       `json:"history,omitempty"` // 每一层的构建历史
+}
+
+// ContainerConfig 镜像中保存的容器默认运行参数
+type ContainerConfig struct {
+	User       string            `json:"User,omitempty"`
+	Env        []string          `json:"Env,omitempty"`
+	Entrypoint []string          `json:"Entrypoint,omitempty"`
+	Cmd        []string          `json:"Cmd,omitempty"`
+	WorkingDir string            `json:"WorkingDir,omitempty"`
+	Labels     map[string]string `json:"Labels,omitempty"`
+}
+
+// History 镜像每一层的构建历史
+type History struct {
+	Created    string `json:"created,omitempty"`
+	CreatedBy  string `json:"created_by,omitempty"`
+	Author     string `json:"author,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	EmptyLayer bool   `json:"empty_layer,omitempty"`
+}
+
+// RootFS 镜像的层，DiffIds 按照从底层到顶层的顺序排列
+type RootFS struct {
+	Type    string   `json:"type"`
+	DiffIds []string `json:"diff_ids"`
+}
+
+// Image 镜像存储中的镜像
+type Image struct {
+	Id     string  `json:"id"`     // 镜像Id，sha256:{hex}
+	Config *Config `json:"config"` // 镜像配置
+	Size   int64   `json:"size"`   // 所有层未压缩的大小之和
+}
+
+// metadata 镜像的元数据，记录引用该镜像的容器，被容器引用的镜像不能删除
+// 镜像被强制删除后元数据会保留到最后一个容器释放引用，DiffIds 记录需要在那时回收的层
+type metadata struct {
+	Containers []string `json:"containers"`
+	DiffIds    []string `json:"diffIds,omitempty"`
+}
+
+// Create 保存镜像配置，镜像引用的层必须已经在镜像存储中，返回镜像Id
+func Create(config []byte) (string, error) {
+	cfg := new(Config)
+	if err := json.Unmarshal(config, cfg); err != nil {
+		return "", fmt.Errorf("invalid image config, %v", err)
+	}
+	for _, diffId := range cfg.RootFS.DiffIds {
+		if _, err := GetLayer(diffId); err != nil {
+			return "", err
+		}
+	}
+
+	sum := sha256.Sum256(config)
+	imageId := digestAlgorithm + ":" + hex.EncodeToString(sum[:])
+	err := withLock(func() error {
+		contentPath := imageContentPath(imageId)
+		if err := os.MkdirAll(filepath.Dir(contentPath), 0700); err != nil {
+			return err
+		}
+		return os.WriteFile(contentPath, config, 0600)
+	})
+	if err != nil {
+		return "", err
+	}
+	return imageId, nil
+}
+
+// Get 根据完整的镜像Id读取镜像
+func Get(imageId string) (*Image, error) {
+	if !strings.HasPrefix(imageId, digestAlgorithm+":") {
+		imageId = digestAlgorithm + ":" + imageId
+	}
+	content, err := os.ReadFile(imageContentPath(imageId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no such image: %s", imageId)
+		}
+		return nil, err
+	}
+	img := &Image{Id: imageId, Config: new(Config)}
+	if err = json.Unmarshal(content, img.Config); err != nil {
+		return nil, err
+	}
+	for _, diffId := range img.Config.RootFS.DiffIds {
+		layer, err := GetLayer(diffId)
+		if err != nil {
+			return nil, err
+		}
+		img.Size += layer.Size
+	}
+	return img, nil
+}
+
+// RawConfig 读取镜像配置的原始内容
+func RawConfig(imageId string) ([]byte, error) {
+	return os.ReadFile(imageContentPath(imageId))
+}
+
+// List 读取镜像存储中的所有镜像Id
+func List() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, imageContentDir, digestAlgorithm))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	imageIds := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		imageIds = append(imageIds, digestAlgorithm+":"+entry.Name())
+	}
+	sort.Strings(imageIds)
+	return imageIds, nil
+}
+
+// LowerDirs 获取镜像各层解压后的目录，按照 overlay lowerdir 的要求从顶层到底层排列
+// 相同的层只保留最上面的一个，overlay 不允许重复的 lowerdir，下面重复的层被上面的完全覆盖，去掉后内容不变
+func (img *Image) LowerDirs() []string {
+	diffIds := img.Config.RootFS.DiffIds
+	dirs := make([]string, 0, len(diffIds))
+	seen := make(map[string]bool)
+	for i := len(diffIds) - 1; i >= 0; i-- {
+		if seen[diffIds[i]] {
+			continue
+		}
+		seen[diffIds[i]] = true
+		dirs = append(dirs, LayerPath(diffIds[i]))
+	}
+	return dirs
+}
+
+// Acquire 记录容器对镜像的引用
+func Acquire(imageId, containerId string) error {
+	return withLock(func() error {
+		if _, err := os.Stat(imageContentPath(imageId)); err != nil {
+			return fmt.Errorf("no such image: %s", imageId)
+		}
+		meta, err := readMetadata(imageId)
+		if err != nil {
+			return err
+		}
+		for _, id := range meta.Containers {
+			if id == containerId {
+				return nil
+			}
+		}
+		meta.Containers = append(meta.Containers, containerId)
+		return writeMetadata(imageId, meta)
+	})
+}
+
+// Release 删除容器对镜像的引用
+// 镜像已经被强制删除时，最后一个容器释放引用后删除元数据并回收不再使用的层
+func Release(imageId, containerId string) error {
+	return withLock(func() error {
+		meta, err := readMetadata(imageId)
+		if err != nil {
+			return err
+		}
+		containers := meta.Containers[:0]
+		for _, id := range meta.Containers {
+			if id != containerId && containerExists(id) {
+				containers = append(containers, id)
+			}
+		}
+		meta.Containers = containers
+		if _, err = os.Stat(imageContentPath(imageId)); err == nil {
+			return writeMetadata(imageId, meta)
+		}
+		if len(meta.Containers) > 0 {
+			return writeMetadata(imageId, meta)
+		}
+		if err = os.Remove(imageMetadataPath(imageId)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return removeUnusedLayers(meta.DiffIds)
+	})
+}
+
+// Containers 获取仍然存在的、引用该镜像的容器
+func Containers(imageId string) ([]string, error) {
+	meta, err := readMetadata(imageId)
+	if err != nil {
+		return nil, err
+	}
+	var containers []string
+	for _, containerId := range meta.Containers {
+		if containerExists(containerId) {
+			containers = append(containers, containerId)
+		}
+	}
+	return containers, nil
+}
+
+// Delete 删除镜像以及指向它的镜像名，同时删除不再被其他镜像和容器使用的层
+// 被容器引用的镜像只有 force 为 true 时才能删除，此时镜像的层会保留给容器继续使用，
+// 等最后一个容器释放引用时再回收
+func Delete(imageId string, force bool) error {
+	return withLock(func() error {
+		img, err := Get(imageId)
+		if err != nil {
+			return err
+		}
+		containers, err := Containers(img.Id)
+		if err != nil {
+			return err
+		}
+		if len(containers) > 0 && !force {
+			return fmt.Errorf("image %s is being used by containers %v", img.Id, containers)
+		}
+
+		if err = removeReferences(img.Id); err != nil {
+			return err
+		}
+		if err = os.Remove(imageContentPath(img.Id)); err != nil {
+			return err
+		}
+		if len(containers) > 0 {
+			err = writeMetadata(img.Id, &metadata{Containers: containers, DiffIds: img.Config.RootFS.DiffIds})
+		} else {
+			err = os.Remove(imageMetadataPath(img.Id))
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		logrus.Infof("deleted image %s", img.Id)
+		return removeUnusedLayers(img.Config.RootFS.DiffIds)
+	})
+}
+
+// Removed rmi 的结果，Untagged 为删除的镜像名，Deleted 为删除的镜像Id，只删除镜像名时为空
+type Removed struct {
+	Untagged []string
+	Deleted  string
+}
+
+// Remove 按照 docker rmi 的规则删除镜像
+// 通过镜像名删除且镜像还有其他镜像名时只删除这个镜像名；
+// 通过镜像Id删除有多个镜像名的镜像需要 force，删除镜像时同时删除指向它的所有镜像名
+func Remove(ref string, force bool) (*Removed, error) {
+	imageId, err := Resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := References(imageId)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := NormalizeReference(ref)
+	byName := err == nil && slices.Contains(refs, normalized)
+
+	if len(refs) > 1 {
+		if byName {
+			if _, err = Untag(normalized); err != nil {
+				return nil, err
+			}
+			return &Removed{Untagged: []string{normalized}}, nil
+		}
+		if !force {
+			return nil, fmt.Errorf("image %s is referenced in multiple repositories %v, use -f to force", ref, refs)
+		}
+	}
+	if err = Delete(imageId, force); err != nil {
+		return nil, err
+	}
+	return &Removed{Untagged: refs, Deleted: imageId}, nil
+}
+
+// removeUnusedLayers 删除没有被任何镜像或者容器引用的层，调用方需要持有镜像存储的锁
+func removeUnusedLayers(diffIds []string) error {
+	imageIds, err := List()
+	if err != nil {
+		return err
+	}
+	inUse, err := containerLayers()
+	if err != nil {
+		logrus.Errorf("read container infos fail, %v", err)
+		// 无法确定层是否被容器使用时不删除
+		return nil
+	}
+	used := make(map[string]bool)
+	for _, imageId := range imageIds {
+		img, err := Get(imageId)
+		if err != nil {
+			logrus.Errorf("read image %s fail, %v", imageId, err)
+			// 无法确定层是否被使用时不删除
+			return nil
+		}
+		for _, diffId := range img.Config.RootFS.DiffIds {
+			used[diffId] = true
+		}
+	}
+	for _, diffId := range diffIds {
+		if used[diffId] || inUse[LayerPath(diffId)] {
+			continue
+		}
+		if err = removeLayer(diffId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readMetadata(imageId string) (*metadata, error) {
+	meta := new(metadata)
+	content, err := os.ReadFile(imageMetadataPath(imageId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return meta, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(content, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func writeMetadata(imageId string, meta *metadata) error {
+	metaPath := imageMetadataPath(imageId)
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0700); err != nil {
+		return err
+	}
+	content, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(metaPath, content, 0600)
+}
@@ -0,0 +1,251 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTar 生成包含指定文件的 tar
+func newTar(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for name, content := range files {
+		assert.Nil(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tw.Close())
+	return buf.Bytes()
+}
+
+func setupStore(t *testing.T) map[string]bool {
+	SetRoot(t.TempDir())
+	existing := map[string]bool{}
+	containerExists = func(containerId string) bool {
+		return existing[containerId]
+	}
+	containerLayers = func() (map[string]bool, error) {
+		return map[string]bool{}, nil
+	}
+	return existing
+}
+
+func TestApplyLayer(t *testing.T) {
+	ast := assert.New(t)
+	setupStore(t)
+
+	content := newTar(t, map[string]string{"etc/hostname": "mydocker\n"})
+	layer, err := ApplyLayer(bytes.NewReader(content))
+	ast.Nil(err)
+	ast.Equal(int64(len(content)), layer.Size)
+	data, err := os.ReadFile(filepath.Join(LayerPath(layer.DiffId), "etc/hostname"))
+	ast.Nil(err)
+	ast.Equal("mydocker\n", string(data))
+
+	// gzip 压缩的相同内容得到相同的 diffId
+	gz := new(bytes.Buffer)
+	zw := gzip.NewWriter(gz)
+	_, _ = zw.Write(content)
+	ast.Nil(zw.Close())
+	same, err := ApplyLayer(gz)
+	ast.Nil(err)
+	ast.Equal(layer, same)
+
+	loaded, err := GetLayer(layer.DiffId)
+	ast.Nil(err)
+	ast.Equal(layer, loaded)
+	_, err = GetLayer("sha256:0000")
+	ast.NotNil(err)
+}
+
+func TestImageLifecycle(t *testing.T) {
+	ast := assert.New(t)
+	existing := setupStore(t)
+
+	imageId, err := ImportRootfs(bytes.NewReader(newTar(t, map[string]string{"bin/sh": "#!"})), "busybox", nil)
+	ast.Nil(err)
+	resolved, err := Resolve("busybox:latest")
+	ast.Nil(err)
+	ast.Equal(imageId, resolved)
+	resolved, err = Resolve(digestHex(imageId)[:12])
+	ast.Nil(err)
+	ast.Equal(imageId, resolved)
+
+	img, err := Lookup("busybox")
+	ast.Nil(err)
+	ast.Len(img.Config.RootFS.DiffIds, 1)
+	ast.Equal([]string{LayerPath(img.Config.RootFS.DiffIds[0])}, img.LowerDirs())
+
+	ast.Nil(Tag("mybox:v1", imageId))
+	refs, err := References(imageId)
+	ast.Nil(err)
+	ast.Equal([]string{"busybox:latest", "mybox:v1"}, refs)
+
+	// 被容器引用的镜像不能删除
+	existing["1234567890"] = true
+	ast.Nil(Acquire(imageId, "1234567890"))
+	ast.NotNil(Delete(imageId, false))
+	ast.Nil(Release(imageId, "1234567890"))
+
+	ast.Nil(Delete(imageId, false))
+	_, err = Resolve("busybox")
+	ast.NotNil(err)
+	_, err = os.Stat(LayerPath(img.Config.RootFS.DiffIds[0]))
+	ast.True(os.IsNotExist(err))
+}
+
+func TestRemove(t *testing.T) {
+	ast := assert.New(t)
+	existing := setupStore(t)
+
+	imageId, err := ImportRootfs(bytes.NewReader(newTar(t, map[string]string{"bin/sh": "#!"})), "busybox", nil)
+	ast.Nil(err)
+	ast.Nil(Tag("mybox:v1", imageId))
+
+	// 有多个镜像名时通过镜像Id删除需要 force
+	_, err = Remove(digestHex(imageId)[:12], false)
+	ast.NotNil(err)
+
+	// 通过镜像名删除时只删除这个镜像名
+	removed, err := Remove("mybox:v1", false)
+	ast.Nil(err)
+	ast.Equal(&Removed{Untagged: []string{"mybox:v1"}}, removed)
+	_, err = Get(imageId)
+	ast.Nil(err)
+
+	existing["1234567890"] = true
+	ast.Nil(Acquire(imageId, "1234567890"))
+	_, err = Remove("busybox", false)
+	ast.NotNil(err)
+	delete(existing, "1234567890")
+
+	removed, err = Remove("busybox", false)
+	ast.Nil(err)
+	ast.Equal(&Removed{Untagged: []string{"busybox:latest"}, Deleted: imageId}, removed)
+	_, err = Get(imageId)
+	ast.NotNil(err)
+	_, err = Remove("busybox", false)
+	ast.NotNil(err)
+}
+
+func TestDeleteKeepsContainerLayers(t *testing.T) {
+	ast := assert.New(t)
+	existing := setupStore(t)
+	lowerDirs := map[string]bool{}
+	containerLayers = func() (map[string]bool, error) {
+		return lowerDirs, nil
+	}
+
+	baseId, err := ImportRootfs(bytes.NewReader(newTar(t, map[string]string{"bin/sh": "#!"})), "base", nil)
+	ast.Nil(err)
+	aId, err := Commit(baseId, bytes.NewReader(newTar(t, map[string]string{"a": "a"})), &CommitOptions{Ref: "a"})
+	ast.Nil(err)
+	bId, err := Commit(baseId, bytes.NewReader(newTar(t, map[string]string{"b": "b"})), &CommitOptions{Ref: "b"})
+	ast.Nil(err)
+	ast.Nil(Delete(baseId, false))
+	a, err := Get(aId)
+	ast.Nil(err)
+	b, err := Get(bId)
+	ast.Nil(err)
+	baseLayer, aLayer, bLayer := a.LowerDirs()[1], a.LowerDirs()[0], b.LowerDirs()[0]
+
+	// 容器使用镜像 a 时强制删除镜像 a，镜像的层留给容器使用
+	existing["1234567890"] = true
+	ast.Nil(Acquire(aId, "1234567890"))
+	for _, dir := range a.LowerDirs() {
+		lowerDirs[dir] = true
+	}
+	ast.NotNil(Delete(aId, false))
+	ast.Nil(Delete(aId, true))
+	ast.DirExists(aLayer)
+
+	// 删除共享基础层的镜像 b 时不能删除容器还在使用的基础层
+	ast.Nil(Delete(bId, false))
+	ast.DirExists(baseLayer)
+	ast.NoDirExists(bLayer)
+
+	// 最后一个容器删除后回收镜像 a 的层
+	delete(existing, "1234567890")
+	clear(lowerDirs)
+	ast.Nil(Release(aId, "1234567890"))
+	ast.NoDirExists(aLayer)
+	ast.NoDirExists(baseLayer)
+	ast.NoFileExists(imageMetadataPath(aId))
+}
+
+func TestCommit(t *testing.T) {
+	ast := assert.New(t)
+	setupStore(t)
+
+	parentId, err := ImportRootfs(bytes.NewReader(newTar(t, map[string]string{"bin/sh": "#!"})), "busybox", &ContainerConfig{Cmd: []string{"sh"}})
+	ast.Nil(err)
+	diff := newTar(t, map[string]string{"etc/motd": "hello"})
+	imageId, err := Commit(parentId, bytes.NewReader(diff), &CommitOptions{
+		Ref:       "mybox:v1",
+		Author:    "mydocker",
+		Comment:   "add motd",
+		CreatedBy: "sh -c echo hello > /etc/motd",
+	})
+	ast.Nil(err)
+
+	img, err := Lookup("mybox:v1")
+	ast.Nil(err)
+	ast.Equal(imageId, img.Id)
+	parent, err := Get(parentId)
+	ast.Nil(err)
+	ast.Equal(append(parent.Config.RootFS.DiffIds, sha256Digest(diff)), img.Config.RootFS.DiffIds)
+	ast.Equal([]string{"sh"}, img.Config.Config.Cmd)
+	ast.Equal("mydocker", img.Config.Author)
+	ast.Len(img.Config.History, 2)
+	ast.Equal("add motd", img.Config.History[1].Comment)
+	ast.Equal("sh -c echo hello > /etc/motd", img.Config.History[1].CreatedBy)
+
+	// 新镜像的 lowerdir 顶层是新提交的层
+	dirs := img.LowerDirs()
+	ast.Len(dirs, 2)
+	content, err := os.ReadFile(filepath.Join(dirs[0], "etc/motd"))
+	ast.Nil(err)
+	ast.Equal("hello", string(content))
+
+	_, err = Commit("sha256:0000", bytes.NewReader(diff), &CommitOptions{})
+	ast.NotNil(err)
+}
+
+func TestCommitEmptyLayer(t *testing.T) {
+	ast := assert.New(t)
+	setupStore(t)
+
+	parentId, err := ImportRootfs(bytes.NewReader(newTar(t, map[string]string{"bin/sh": "#!"})), "busybox", nil)
+	ast.Nil(err)
+	parent, err := Get(parentId)
+	ast.Nil(err)
+
+	// 没有改动的容器提交两次，只增加历史，不增加层
+	firstId, err := Commit(parentId, bytes.NewReader(newTar(t, nil)), &CommitOptions{Comment: "first"})
+	ast.Nil(err)
+	secondId, err := Commit(firstId, bytes.NewReader(newTar(t, nil)), &CommitOptions{Comment: "second"})
+	ast.Nil(err)
+	img, err := Get(secondId)
+	ast.Nil(err)
+	ast.Equal(parent.Config.RootFS.DiffIds, img.Config.RootFS.DiffIds)
+	ast.Equal(parent.LowerDirs(), img.LowerDirs())
+	ast.Len(img.Config.History, 3)
+	ast.True(img.Config.History[1].EmptyLayer)
+	ast.True(img.Config.History[2].EmptyLayer)
+	ast.Equal("second", img.Config.History[2].Comment)
+}
+
+func TestLowerDirsDuplicateLayers(t *testing.T) {
+	ast := assert.New(t)
+	setupStore(t)
+
+	// 重复的层只保留最上面的一个
+	img := &Image{Config: &Config{RootFS: RootFS{DiffIds: []string{"sha256:aa", "sha256:bb", "sha256:aa", "sha256:cc"}}}}
+	ast.Equal([]string{LayerPath("sha256:cc"), LayerPath("sha256:aa"), LayerPath("sha256:bb")}, img.LowerDirs())
+}
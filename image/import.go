@@ -0,0 +1,43 @@
+package image
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ImportRootfs 把一个完整的 rootfs tar 导入为只有一层的镜像，ref 不为空时同时设置镜像名
+// containerConfig 为镜像中保存的容器默认运行参数，可以为 nil
+func ImportRootfs(r io.Reader, ref string, containerConfig *ContainerConfig) (string, error) {
+	return Commit("", r, &CommitOptions{Ref: ref, Config: containerConfig})
+}
+
+// Lookup 根据镜像名或者镜像Id找到镜像
+// 兼容旧版本保存在 /root/{imageName}.tar 的镜像，第一次使用时导入到镜像存储中
+func Lookup(ref string) (*Image, error) {
+	imageId, err := Resolve(ref)
+	if err == nil {
+		return Get(imageId)
+	}
+
+	// 旧版本的镜像名就是文件名，不带 tag 和路径
+	if _, nameErr := NormalizeReference(ref); nameErr != nil || strings.ContainsAny(ref, "/:") {
+		return nil, err
+	}
+	legacyTar := legacyImageDir + ref + ".tar"
+	file, openErr := os.Open(legacyTar)
+	if openErr != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	logrus.Infof("import legacy image %s", legacyTar)
+	if imageId, err = ImportRootfs(file, ref, nil); err != nil {
+		return nil, fmt.Errorf("import legacy image %s error, %v", legacyTar, err)
+	}
+	return Get(imageId)
+}
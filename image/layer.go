@@ -0,0 +1,150 @@
+package image
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/pjimming/mydocker/archive"
+)
+
+// Layer 镜像存储中解压后的层
+type Layer struct {
+	DiffId string `json:"diffId"` // 未压缩的层 tar 的摘要
+	Size   int64  `json:"size"`   // 未压缩的层 tar 的大小
+}
+
+// countWriter 统计写入的字节数
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// ApplyLayer 把层 tar 解压到镜像存储中，支持 gzip 压缩的 tar，层中的 whiteout 文件转换为 overlay 的格式
+// 层按照未压缩 tar 的摘要寻址，相同内容的层只解压一次
+func ApplyLayer(r io.Reader) (*Layer, error) {
+	return applyLayer(r, "")
+}
+
+// applyLayer 解压层，diffId 不为空时先检查摘要，不一致的层不会放到镜像存储中
+func applyLayer(r io.Reader, diffId string) (*Layer, error) {
+	tmp, err := newTmpDir("layer-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(tmp)
+	}()
+
+	reader, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	hasher := sha256.New()
+	counter := &countWriter{}
+	tee := io.TeeReader(reader, io.MultiWriter(hasher, counter))
+
+	if err = archive.Untar(tee, tmp, &archive.UntarOptions{OCIWhiteouts: true}); err != nil {
+		return nil, fmt.Errorf("untar layer error, %v", err)
+	}
+	// 读到归档结束标记就会停止解压，剩余的填充数据也要计入摘要
+	if _, err = io.Copy(io.Discard, tee); err != nil {
+		return nil, err
+	}
+
+	layer := &Layer{
+		DiffId: digestAlgorithm + ":" + hex.EncodeToString(hasher.Sum(nil)),
+		Size:   counter.n,
+	}
+	if diffId != "" && layer.DiffId != diffId {
+		return nil, fmt.Errorf("layer diff id mismatch, expected %s, got %s", diffId, layer.DiffId)
+	}
+	err = withLock(func() error {
+		dir := layerDir(layer.DiffId)
+		if _, err := os.Stat(filepath.Join(dir, layerConfigName)); err == nil {
+			logrus.Infof("layer %s already exists", layer.DiffId)
+			return nil
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, layerDiffDir)); err != nil {
+			return err
+		}
+		content, err := json.Marshal(layer)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, layerConfigName), content, 0600)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return layer, nil
+}
+
+// GetLayer 读取层的元数据
+func GetLayer(diffId string) (*Layer, error) {
+	content, err := os.ReadFile(filepath.Join(layerDir(diffId), layerConfigName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no such layer: %s", diffId)
+		}
+		return nil, err
+	}
+	layer := new(Layer)
+	if err = json.Unmarshal(content, layer); err != nil {
+		return nil, err
+	}
+	return layer, nil
+}
+
+// LayerPath 获取层解压后的目录
+func LayerPath(diffId string) string {
+	return filepath.Join(layerDir(diffId), layerDiffDir)
+}
+
+// removeLayer 删除层，调用方需要持有镜像存储的锁
+func removeLayer(diffId string) error {
+	logrus.Infof("remove layer %s", diffId)
+	return os.RemoveAll(layerDir(diffId))
+}
+
+// decompress 根据文件头判断是否是 gzip 压缩的数据
+func decompress(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(buffered)
+	}
+	return buffered, nil
+}
+
+// newTmpDir 在镜像存储中创建临时目录，与层目录在同一个文件系统中，解压完成后可以直接 rename
+func newTmpDir(prefix string) (string, error) {
+	dir := filepath.Join(root, tmpDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	tmp, err := os.MkdirTemp(dir, prefix)
+	if err != nil {
+		return "", err
+	}
+	// 层的根目录会成为容器的根目录，MkdirTemp 创建的 0700 目录会导致非 root 用户无法访问
+	return tmp, os.Chmod(tmp, 0755)
+}
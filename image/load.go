@@ -0,0 +1,271 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/pjimming/mydocker/archive"
+)
+
+const (
+	// dockerManifestName docker save 格式的清单文件
+	dockerManifestName = "manifest.json"
+	// ociIndexName OCI image layout 的入口文件
+	ociIndexName = "index.json"
+	// ociBlobsDir OCI image layout 中保存 blob 的目录
+	ociBlobsDir = "blobs"
+)
+
+// Loaded 导入的镜像
+type Loaded struct {
+	Id   string   // 镜像Id
+	Refs []string // 镜像名
+}
+
+// dockerManifestItem docker save 格式的 manifest.json 中的一项，路径都相对于归档根目录
+type dockerManifestItem struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// Load 导入 docker save(v1.2) 或者 OCI image layout 格式的镜像归档，支持 gzip 压缩
+// 导入时检查 blob 和层的摘要，层按照镜像配置中的 diff_ids 保存到镜像存储
+func Load(r io.Reader) ([]*Loaded, error) {
+	dir, err := newTmpDir("load-")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	reader, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	if err = archive.Untar(reader, dir, nil); err != nil {
+		return nil, fmt.Errorf("extract image archive error, %v", err)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, dockerManifestName)); err == nil {
+		return loadDockerArchive(dir)
+	}
+	if _, err = os.Stat(filepath.Join(dir, ociIndexName)); err == nil {
+		return loadOCILayout(dir)
+	}
+	return nil, fmt.Errorf("neither %s nor %s found in image archive", dockerManifestName, ociIndexName)
+}
+
+// loadDockerArchive 导入 docker save 格式的归档，层的摘要与镜像配置中的 diff_ids 对比
+func loadDockerArchive(dir string) ([]*Loaded, error) {
+	var items []dockerManifestItem
+	if err := readJsonInDir(dir, dockerManifestName, &items); err != nil {
+		return nil, err
+	}
+	loaded := make([]*Loaded, 0, len(items))
+	for _, item := range items {
+		configPath, err := pathInDir(dir, item.Config)
+		if err != nil {
+			return nil, err
+		}
+		layerPaths := make([]string, 0, len(item.Layers))
+		for _, layer := range item.Layers {
+			layerPath, err := pathInDir(dir, layer)
+			if err != nil {
+				return nil, err
+			}
+			layerPaths = append(layerPaths, layerPath)
+		}
+		imageId, err := createImage(configPath, layerPaths)
+		if err != nil {
+			return nil, err
+		}
+		if err = tagImage(imageId, item.RepoTags); err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, &Loaded{Id: imageId, Refs: item.RepoTags})
+	}
+	return loaded, nil
+}
+
+// loadOCILayout 导入 OCI image layout 格式的归档，index 中的 manifest 可以是嵌套的 index
+func loadOCILayout(dir string) ([]*Loaded, error) {
+	index := new(Index)
+	if err := readJsonInDir(dir, ociIndexName, index); err != nil {
+		return nil, err
+	}
+	loaded := make([]*Loaded, 0, len(index.Manifests))
+	for _, desc := range index.Manifests {
+		imageId, err := loadOCIDescriptor(dir, desc)
+		if err != nil {
+			return nil, err
+		}
+		var refs []string
+		if ref := refFromAnnotations(desc.Annotations); ref != "" {
+			refs = append(refs, ref)
+		}
+		if err = tagImage(imageId, refs); err != nil {
+			return nil, err
+		}
+		loaded = append(loaded, &Loaded{Id: imageId, Refs: refs})
+	}
+	return loaded, nil
+}
+
+func loadOCIDescriptor(dir string, desc Descriptor) (string, error) {
+	blobPath, err := verifiedBlob(dir, desc.Digest)
+	if err != nil {
+		return "", err
+	}
+	if desc.IsIndex() {
+		index := new(Index)
+		if err = readJsonFile(blobPath, index); err != nil {
+			return "", err
+		}
+		manifestDesc, err := SelectManifest(index.Manifests)
+		if err != nil {
+			return "", err
+		}
+		return loadOCIDescriptor(dir, *manifestDesc)
+	}
+
+	manifest := new(Manifest)
+	if err = readJsonFile(blobPath, manifest); err != nil {
+		return "", err
+	}
+	configPath, err := verifiedBlob(dir, manifest.Config.Digest)
+	if err != nil {
+		return "", err
+	}
+	layerPaths := make([]string, 0, len(manifest.Layers))
+	for _, layer := range manifest.Layers {
+		if strings.Contains(layer.MediaType, "zstd") {
+			return "", fmt.Errorf("unsupported layer media type %s", layer.MediaType)
+		}
+		layerPath, err := verifiedBlob(dir, layer.Digest)
+		if err != nil {
+			return "", err
+		}
+		layerPaths = append(layerPaths, layerPath)
+	}
+	return createImage(configPath, layerPaths)
+}
+
+// createImage 按顺序导入镜像的层，检查层的 diffId 与镜像配置一致后保存镜像配置
+// 镜像存储中已经存在的层直接跳过
+func createImage(configPath string, layerPaths []string) (string, error) {
+	config, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", err
+	}
+	cfg := new(Config)
+	if err = json.Unmarshal(config, cfg); err != nil {
+		return "", fmt.Errorf("invalid image config %s, %v", configPath, err)
+	}
+	if len(cfg.RootFS.DiffIds) != len(layerPaths) {
+		return "", fmt.Errorf("image config has %d layers, but got %d", len(cfg.RootFS.DiffIds), len(layerPaths))
+	}
+	for i, layerPath := range layerPaths {
+		diffId := cfg.RootFS.DiffIds[i]
+		if _, err = GetLayer(diffId); err == nil {
+			continue
+		}
+		if err = applyLayerFile(layerPath, diffId); err != nil {
+			return "", err
+		}
+	}
+	return Create(config)
+}
+
+// applyLayerFile 导入层文件，层的 diffId 必须与期望的一致
+func applyLayerFile(layerPath, diffId string) error {
+	file, err := os.Open(layerPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	if _, err = applyLayer(file, diffId); err != nil {
+		return fmt.Errorf("apply layer %s error, %v", layerPath, err)
+	}
+	logrus.Infof("loaded layer %s", diffId)
+	return nil
+}
+
+func tagImage(imageId string, refs []string) error {
+	for _, ref := range refs {
+		if err := Tag(ref, imageId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refFromAnnotations 从 annotation 中获取完整的镜像名
+// org.opencontainers.image.ref.name 可能只有 tag，这种情况无法确定镜像名
+func refFromAnnotations(annotations map[string]string) string {
+	if ref := annotations[annotationContainerdName]; ref != "" {
+		return ref
+	}
+	if ref := annotations[annotationRefName]; strings.Contains(ref, ":") {
+		return ref
+	}
+	return ""
+}
+
+// verifiedBlob 获取 OCI image layout 中 blob 的路径并检查摘要
+func verifiedBlob(dir, digest string) (string, error) {
+	if err := ValidateDigest(digest); err != nil {
+		return "", err
+	}
+	blobPath, err := pathInDir(dir, filepath.Join(ociBlobsDir, digestAlgorithm, digestHex(digest)))
+	if err != nil {
+		return "", err
+	}
+	if err = verifyFile(blobPath, digest); err != nil {
+		return "", err
+	}
+	return blobPath, nil
+}
+
+// pathInDir 获取归档中文件的路径，解析符号链接后路径不能超出归档目录
+func pathInDir(dir, name string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside of the image archive", name)
+	}
+	return resolved, nil
+}
+
+func readJsonInDir(dir, name string, v any) error {
+	filePath, err := pathInDir(dir, name)
+	if err != nil {
+		return err
+	}
+	return readJsonFile(filePath, v)
+}
+
+func readJsonFile(filePath string, v any) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("parse %s error, %v", filepath.Base(filePath), err)
+	}
+	return nil
+}
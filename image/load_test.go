@@ -0,0 +1,233 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+
+	"github.com/pjimming/mydocker/archive"
+)
+
+type tarEntry struct {
+	name    string
+	content string
+	dir     bool
+}
+
+// newOrderedTar 按顺序生成 tar，目录以 / 结尾
+func newOrderedTar(t *testing.T, entries ...tarEntry) []byte {
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if entry.dir {
+			header.Mode, header.Size, header.Typeflag = 0755, 0, tar.TypeDir
+		}
+		assert.Nil(t, tw.WriteHeader(header))
+		_, err := tw.Write([]byte(entry.content))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tw.Close())
+	return buf.Bytes()
+}
+
+func sha256Digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// testLayers 两个层，上层删除了下层的 a 文件并把 d 目录变为不透明目录
+func testLayers(t *testing.T) ([]byte, []byte) {
+	lower := newOrderedTar(t,
+		tarEntry{name: "a", content: "a"},
+		tarEntry{name: "d/", dir: true},
+		tarEntry{name: "d/old", content: "old"},
+	)
+	upper := newOrderedTar(t,
+		tarEntry{name: ".wh.a"},
+		tarEntry{name: "d/", dir: true},
+		tarEntry{name: "d/.wh..wh..opq"},
+		tarEntry{name: "d/new", content: "new"},
+	)
+	return lower, upper
+}
+
+func testConfig(t *testing.T, layers ...[]byte) []byte {
+	cfg := &Config{
+		Architecture: "amd64",
+		OS:           "linux",
+		Config:       ContainerConfig{Env: []string{"PATH=/bin"}, Cmd: []string{"sh"}, WorkingDir: "/d"},
+		RootFS:       RootFS{Type: "layers"},
+	}
+	for _, layer := range layers {
+		cfg.RootFS.DiffIds = append(cfg.RootFS.DiffIds, sha256Digest(layer))
+	}
+	content, err := json.Marshal(cfg)
+	assert.Nil(t, err)
+	return content
+}
+
+func mustJson(t *testing.T, v any) []byte {
+	content, err := json.Marshal(v)
+	assert.Nil(t, err)
+	return content
+}
+
+func TestLoadDockerArchive(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("whiteout conversion requires root")
+	}
+	ast := assert.New(t)
+	setupStore(t)
+
+	lower, upper := testLayers(t)
+	config := testConfig(t, lower, upper)
+	configName := digestHex(sha256Digest(config)) + ".json"
+	content := newOrderedTar(t,
+		tarEntry{name: "lower/layer.tar", content: string(lower)},
+		tarEntry{name: "upper/layer.tar", content: string(upper)},
+		tarEntry{name: configName, content: string(config)},
+		tarEntry{name: "manifest.json", content: string(mustJson(t, []dockerManifestItem{{
+			Config:   configName,
+			RepoTags: []string{"test:v1"},
+			Layers:   []string{"lower/layer.tar", "upper/layer.tar"},
+		}}))},
+	)
+
+	loaded, err := Load(bytes.NewReader(content))
+	ast.Nil(err)
+	ast.Len(loaded, 1)
+	ast.Equal(sha256Digest(config), loaded[0].Id)
+
+	img, err := Lookup("test:v1")
+	ast.Nil(err)
+	ast.Equal([]string{"sh"}, img.Config.Config.Cmd)
+	ast.Equal("/d", img.Config.Config.WorkingDir)
+
+	// whiteout 转换为 overlay 的格式
+	upperDir := LayerPath(sha256Digest(upper))
+	var stat unix.Stat_t
+	ast.Nil(unix.Lstat(filepath.Join(upperDir, "a"), &stat))
+	ast.Equal(uint32(unix.S_IFCHR), stat.Mode&unix.S_IFMT)
+	ast.Equal(uint64(0), stat.Rdev)
+	_, err = os.Lstat(filepath.Join(upperDir, ".wh.a"))
+	ast.True(os.IsNotExist(err))
+	opaque := make([]byte, 1)
+	_, err = unix.Getxattr(filepath.Join(upperDir, "d"), archive.OverlayOpaqueXattr, opaque)
+	ast.Nil(err)
+	ast.Equal("y", string(opaque))
+	_, err = os.Lstat(filepath.Join(upperDir, "d", archive.WhiteoutOpaqueDir))
+	ast.True(os.IsNotExist(err))
+
+	// 层的内容与镜像配置不一致
+	setupStore(t)
+	bad := newOrderedTar(t,
+		tarEntry{name: "lower/layer.tar", content: string(upper)},
+		tarEntry{name: "upper/layer.tar", content: string(lower)},
+		tarEntry{name: configName, content: string(config)},
+		tarEntry{name: "manifest.json", content: string(mustJson(t, []dockerManifestItem{{
+			Config: configName,
+			Layers: []string{"lower/layer.tar", "upper/layer.tar"},
+		}}))},
+	)
+	_, err = Load(bytes.NewReader(bad))
+	ast.NotNil(err)
+}
+
+func TestLoadOCILayout(t *testing.T) {
+	ast := assert.New(t)
+	setupStore(t)
+
+	layer := newOrderedTar(t, tarEntry{name: "etc/", dir: true}, tarEntry{name: "etc/os-release", content: "mydocker"})
+	gz := new(bytes.Buffer)
+	zw := gzip.NewWriter(gz)
+	_, _ = zw.Write(layer)
+	ast.Nil(zw.Close())
+	compressed := gz.Bytes()
+	config := testConfig(t, layer)
+	manifest := mustJson(t, &Manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIManifest,
+		Config:        Descriptor{MediaType: "application/vnd.oci.image.config.v1+json", Digest: sha256Digest(config), Size: int64(len(config))},
+		Layers:        []Descriptor{{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: sha256Digest(compressed), Size: int64(len(compressed))}},
+	})
+	nested := mustJson(t, &Index{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIIndex,
+		Manifests: []Descriptor{
+			{MediaType: MediaTypeOCIManifest, Digest: sha256Digest([]byte("other")), Platform: &Platform{OS: "linux", Architecture: "s390x"}},
+			{MediaType: MediaTypeOCIManifest, Digest: sha256Digest(manifest), Size: int64(len(manifest))},
+		},
+	})
+	index := mustJson(t, &Index{
+		SchemaVersion: 2,
+		Manifests: []Descriptor{{
+			MediaType:   MediaTypeOCIIndex,
+			Digest:      sha256Digest(nested),
+			Size:        int64(len(nested)),
+			Annotations: map[string]string{annotationRefName: "oci/test:v2"},
+		}},
+	})
+	blob := func(content []byte) tarEntry {
+		return tarEntry{name: "blobs/sha256/" + digestHex(sha256Digest(content)), content: string(content)}
+	}
+	layout := newOrderedTar(t,
+		tarEntry{name: "oci-layout", content: `{"imageLayoutVersion":"1.0.0"}`},
+		tarEntry{name: "index.json", content: string(index)},
+		blob(nested), blob(manifest), blob(config), blob(compressed),
+	)
+
+	loaded, err := Load(bytes.NewReader(layout))
+	ast.Nil(err)
+	ast.Len(loaded, 1)
+	ast.Equal([]string{"oci/test:v2"}, loaded[0].Refs)
+	content, err := os.ReadFile(filepath.Join(LayerPath(sha256Digest(layer)), "etc/os-release"))
+	ast.Nil(err)
+	ast.Equal("mydocker", string(content))
+
+	// blob 被篡改
+	setupStore(t)
+	corrupted := newOrderedTar(t,
+		tarEntry{name: "index.json", content: string(index)},
+		blob(nested), blob(manifest), blob(config),
+		tarEntry{name: "blobs/sha256/" + digestHex(sha256Digest(compressed)), content: string(layer)},
+	)
+	_, err = Load(bytes.NewReader(corrupted))
+	ast.NotNil(err)
+
+	// 路径穿越
+	_, err = Load(bytes.NewReader(newOrderedTar(t, tarEntry{name: "../index.json", content: "{}"})))
+	ast.NotNil(err)
+}
+
+func TestApplyLayerFileMismatch(t *testing.T) {
+	ast := assert.New(t)
+	setupStore(t)
+
+	shared := newOrderedTar(t, tarEntry{name: "shared", content: "shared"})
+	layer, err := ApplyLayer(bytes.NewReader(shared))
+	ast.Nil(err)
+
+	// 摘要不一致时不能删除其他镜像已经在使用的层
+	layerPath := filepath.Join(t.TempDir(), "layer.tar")
+	ast.Nil(os.WriteFile(layerPath, shared, 0644))
+	ast.NotNil(applyLayerFile(layerPath, sha256Digest([]byte("other"))))
+	_, err = GetLayer(layer.DiffId)
+	ast.Nil(err)
+
+	// 摘要不一致的新层不会放到镜像存储中
+	fresh := newOrderedTar(t, tarEntry{name: "fresh", content: "fresh"})
+	ast.Nil(os.WriteFile(layerPath, fresh, 0644))
+	ast.NotNil(applyLayerFile(layerPath, sha256Digest([]byte("other"))))
+	_, err = os.Stat(layerDir(sha256Digest(fresh)))
+	ast.True(os.IsNotExist(err))
+}
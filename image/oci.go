@@ -0,0 +1,106 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+)
+
+// 镜像相关的 media type，同时支持 OCI 和 docker 的格式
+const (
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+// 镜像名相关的 annotation
+const (
+	annotationRefName        = "org.opencontainers.image.ref.name"
+	annotationContainerdName = "io.containerd.image.name"
+)
+
+// Descriptor OCI 内容描述符，通过摘要引用一个 blob
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *Platform         `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Platform 镜像适用的平台
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// Index OCI image index 或者 docker manifest list
+type Index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// Manifest OCI image manifest 或者 docker image manifest v2
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// IsIndex 判断描述符指向的是否是 index 或者 manifest list
+func (d *Descriptor) IsIndex() bool {
+	return d.MediaType == MediaTypeOCIIndex || d.MediaType == MediaTypeDockerManifestList
+}
+
+// SelectManifest 从 index 中选择当前平台(linux/{GOARCH})的 manifest，
+// 没有平台信息的 manifest 视为适用于所有平台
+func SelectManifest(manifests []Descriptor) (*Descriptor, error) {
+	for i := range manifests {
+		platform := manifests[i].Platform
+		if platform == nil || (platform.OS == "linux" && platform.Architecture == runtime.GOARCH) {
+			return &manifests[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no manifest for platform linux/%s", runtime.GOARCH)
+}
+
+// ValidateDigest 检查摘要格式，只支持 sha256
+func ValidateDigest(digest string) error {
+	hexPart := digestHex(digest)
+	if len(digest) != len(digestAlgorithm)+1+len(hexPart) || len(hexPart) != sha256.Size*2 {
+		return fmt.Errorf("unsupported digest %s", digest)
+	}
+	if _, err := hex.DecodeString(hexPart); err != nil {
+		return fmt.Errorf("invalid digest %s", digest)
+	}
+	return nil
+}
+
+// verifyFile 检查文件内容的摘要
+func verifyFile(filePath, digest string) error {
+	if err := ValidateDigest(digest); err != nil {
+		return err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	hasher := sha256.New()
+	if _, err = io.Copy(hasher, file); err != nil {
+		return err
+	}
+	if actual := digestAlgorithm + ":" + hex.EncodeToString(hasher.Sum(nil)); actual != digest {
+		return fmt.Errorf("digest mismatch for %s, expected %s, got %s", filePath, digest, actual)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxConcurrentDownloads 同时下载的层数
+var maxConcurrentDownloads = 3
+
+// Pull 按照 OCI distribution 协议从 registry 拉取镜像，ref 可以是 name[:tag] 或者 name@sha256:...，
+// 同时指定 tag 和摘要时以摘要为准
+// index 或者 manifest list 中选择当前平台的 manifest，层并发下载并检查摘要后按顺序导入镜像存储
+// 通过 tag 拉取时把 ref 指向新的镜像，返回镜像Id
+func Pull(ref string, out io.Writer) (string, error) {
+	name, reference, digest := ref, "", ""
+	if i := strings.Index(ref, "@"); i >= 0 {
+		name, digest = ref[:i], ref[i+1:]
+		if err := ValidateDigest(digest); err != nil {
+			return "", err
+		}
+		reference = digest
+	}
+	name, tag, err := ParseReference(name)
+	if err != nil {
+		return "", err
+	}
+	if digest == "" {
+		reference = tag
+	}
+
+	host, repo := splitRepository(name)
+	client := newRegistryClient(host, repo)
+	_, _ = fmt.Fprintf(out, "%s: Pulling from %s\n", reference, repo)
+
+	content, mediaType, manifestDigest, err := client.getManifest(reference)
+	if err != nil {
+		return "", err
+	}
+	if mediaType == MediaTypeOCIIndex || mediaType == MediaTypeDockerManifestList {
+		index := new(Index)
+		if err = json.Unmarshal(content, index); err != nil {
+			return "", fmt.Errorf("parse image index error, %v", err)
+		}
+		desc, err := SelectManifest(index.Manifests)
+		if err != nil {
+			return "", err
+		}
+		if content, mediaType, _, err = client.getManifest(desc.Digest); err != nil {
+			return "", err
+		}
+	}
+	if mediaType != MediaTypeOCIManifest && mediaType != MediaTypeDockerManifest {
+		return "", fmt.Errorf("unsupported manifest media type %q", mediaType)
+	}
+	manifest := new(Manifest)
+	if err = json.Unmarshal(content, manifest); err != nil {
+		return "", fmt.Errorf("parse image manifest error, %v", err)
+	}
+
+	config, err := client.getBlob(manifest.Config)
+	if err != nil {
+		return "", err
+	}
+	cfg := new(Config)
+	if err = json.Unmarshal(config, cfg); err != nil {
+		return "", fmt.Errorf("invalid image config, %v", err)
+	}
+	if len(cfg.RootFS.DiffIds) != len(manifest.Layers) {
+		return "", fmt.Errorf("image config has %d layers, but manifest has %d", len(cfg.RootFS.DiffIds), len(manifest.Layers))
+	}
+
+	layerPaths, err := downloadLayers(client, manifest.Layers, cfg.RootFS.DiffIds, out)
+	if err != nil {
+		return "", err
+	}
+	for i, layerPath := range layerPaths {
+		if layerPath == "" {
+			continue
+		}
+		if err = applyLayerFile(layerPath, cfg.RootFS.DiffIds[i]); err != nil {
+			return "", err
+		}
+		_ = os.Remove(layerPath)
+		_, _ = fmt.Fprintf(out, "%s: Pull complete\n", shortDigest(manifest.Layers[i].Digest))
+	}
+
+	imageId, err := Create(config)
+	if err != nil {
+		return "", err
+	}
+	if digest == "" {
+		if err = Tag(name+":"+tag, imageId); err != nil {
+			return "", err
+		}
+	}
+	_, _ = fmt.Fprintf(out, "Digest: %s\n", manifestDigest)
+	return imageId, nil
+}
+
+// downloadLayers 并发下载镜像存储中还没有的层，返回每一层下载后的文件，已经存在的层返回空路径
+func downloadLayers(client *registryClient, layers []Descriptor, diffIds []string, out io.Writer) ([]string, error) {
+	dir := filepath.Join(root, downloadsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	layerPaths := make([]string, len(layers))
+	errs := make([]error, len(layers))
+	sem := make(chan struct{}, maxConcurrentDownloads)
+	var wg sync.WaitGroup
+	for i := range layers {
+		if _, err := GetLayer(diffIds[i]); err == nil {
+			_, _ = fmt.Fprintf(out, "%s: Already exists\n", shortDigest(layers[i].Digest))
+			continue
+		}
+		if err := ValidateDigest(layers[i].Digest); err != nil {
+			return nil, err
+		}
+		layerPaths[i] = filepath.Join(dir, digestHex(layers[i].Digest))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() {
+				<-sem
+			}()
+			errs[i] = client.downloadBlob(layers[i], layerPaths[i])
+			if errs[i] == nil {
+				logrus.Infof("downloaded layer %s", layers[i].Digest)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("download layer %s error, %v", layers[i].Digest, err)
+		}
+	}
+	return layerPaths, nil
+}
+
+// shortDigest 摘要的前 12 位，用于输出下载进度
+func shortDigest(digest string) string {
+	hexPart := digestHex(digest)
+	if len(hexPart) > 12 {
+		return hexPart[:12]
+	}
+	return hexPart
+}
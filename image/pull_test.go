@@ -0,0 +1,224 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRegistry 用于测试的 registry，需要先通过 /token 获取 token
+type fakeRegistry struct {
+	*httptest.Server
+	blobs     map[string][]byte
+	manifests map[string][]byte
+
+	mu         sync.Mutex
+	ranges     []string
+	blobHits   map[string]int
+	tokenScope string
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	reg := &fakeRegistry{
+		blobs:     map[string][]byte{},
+		manifests: map[string][]byte{},
+		blobHits:  map[string]int{},
+	}
+	reg.Server = httptest.NewServer(http.HandlerFunc(reg.serve))
+	t.Cleanup(reg.Close)
+	return reg
+}
+
+func (reg *fakeRegistry) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		reg.mu.Lock()
+		reg.tokenScope = r.URL.Query().Get("scope")
+		reg.mu.Unlock()
+		_, _ = io.WriteString(w, `{"token":"secret"}`)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake",scope="repository:test/app:pull"`, reg.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if ref, ok := strings.CutPrefix(r.URL.Path, "/v2/test/app/manifests/"); ok {
+		content, ok := reg.manifests[ref]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", mustMediaType(content))
+		_, _ = w.Write(content)
+		return
+	}
+	if digest, ok := strings.CutPrefix(r.URL.Path, "/v2/test/app/blobs/"); ok {
+		content, ok := reg.blobs[digest]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		reg.mu.Lock()
+		reg.blobHits[digest]++
+		if rng := r.Header.Get("Range"); rng != "" {
+			reg.ranges = append(reg.ranges, rng)
+		}
+		reg.mu.Unlock()
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+		return
+	}
+	http.NotFound(w, r)
+}
+
+func mustMediaType(content []byte) string {
+	if bytes.Contains(content, []byte(`"manifests"`)) {
+		return MediaTypeDockerManifestList
+	}
+	return MediaTypeDockerManifest
+}
+
+// addBlob 添加 blob，返回描述符
+func (reg *fakeRegistry) addBlob(mediaType string, content []byte) Descriptor {
+	digest := sha256Digest(content)
+	reg.blobs[digest] = content
+	return Descriptor{MediaType: mediaType, Digest: digest, Size: int64(len(content))}
+}
+
+// pushImage 推送一个镜像，tag 指向包含当前平台和其他平台的 manifest list
+func (reg *fakeRegistry) pushImage(t *testing.T, tag string, layers ...[]byte) {
+	manifest := Manifest{SchemaVersion: 2, MediaType: MediaTypeDockerManifest}
+	manifest.Config = reg.addBlob("application/vnd.docker.container.image.v1+json", testConfig(t, layers...))
+	for _, layer := range layers {
+		manifest.Layers = append(manifest.Layers, reg.addBlob("application/vnd.docker.image.rootfs.diff.tar", layer))
+	}
+	content := mustJson(t, manifest)
+	digest := sha256Digest(content)
+	reg.manifests[digest] = content
+
+	other := mustJson(t, Manifest{SchemaVersion: 2, MediaType: MediaTypeDockerManifest})
+	reg.manifests[sha256Digest(other)] = other
+	index := Index{SchemaVersion: 2, MediaType: MediaTypeDockerManifestList, Manifests: []Descriptor{
+		{MediaType: MediaTypeDockerManifest, Digest: sha256Digest(other), Size: int64(len(other)), Platform: &Platform{OS: "linux", Architecture: "not-" + runtime.GOARCH}},
+		{MediaType: MediaTypeDockerManifest, Digest: digest, Size: int64(len(content)), Platform: &Platform{OS: "linux", Architecture: runtime.GOARCH}},
+	}}
+	reg.manifests[tag] = mustJson(t, index)
+}
+
+func (reg *fakeRegistry) host() string {
+	return strings.TrimPrefix(reg.URL, "http://")
+}
+
+func TestSplitRepository(t *testing.T) {
+	ast := assert.New(t)
+	cases := []struct {
+		name, host, repo string
+	}{
+		{"busybox", defaultRegistry, "library/busybox"},
+		{"user/app", defaultRegistry, "user/app"},
+		{"docker.io/library/busybox", defaultRegistry, "library/busybox"},
+		{"localhost/app", "localhost", "app"},
+		{"127.0.0.1:5000/a/b", "127.0.0.1:5000", "a/b"},
+		{"ghcr.io/org/app", "ghcr.io", "org/app"},
+	}
+	for _, c := range cases {
+		host, repo := splitRepository(c.name)
+		ast.Equal(c.host, host, c.name)
+		ast.Equal(c.repo, repo, c.name)
+	}
+	ast.Equal("http", registryScheme("127.0.0.1:5000"))
+	ast.Equal("http", registryScheme("localhost"))
+	ast.Equal("https", registryScheme("ghcr.io"))
+}
+
+func TestPull(t *testing.T) {
+	ast := assert.New(t)
+	setupStore(t)
+	reg := newFakeRegistry(t)
+	lower := newOrderedTar(t, tarEntry{name: "bin/", dir: true}, tarEntry{name: "bin/sh", content: "sh"})
+	upper := newOrderedTar(t, tarEntry{name: "etc/", dir: true}, tarEntry{name: "etc/hostname", content: "app"})
+	reg.pushImage(t, "v1", lower, upper)
+
+	ref := reg.host() + "/test/app:v1"
+	out := new(bytes.Buffer)
+	imageId, err := Pull(ref, out)
+	ast.Nil(err)
+	ast.Equal("repository:test/app:pull", reg.tokenScope)
+	ast.Contains(out.String(), "Pull complete")
+
+	resolved, err := Resolve(ref)
+	ast.Nil(err)
+	ast.Equal(imageId, resolved)
+	img, err := Get(imageId)
+	ast.Nil(err)
+	dirs := img.LowerDirs()
+	ast.Len(dirs, 2)
+	content, err := os.ReadFile(filepath.Join(dirs[0], "etc/hostname"))
+	ast.Nil(err)
+	ast.Equal("app", string(content))
+	content, err = os.ReadFile(filepath.Join(dirs[1], "bin/sh"))
+	ast.Nil(err)
+	ast.Equal("sh", string(content))
+
+	// 已经存在的层不再下载
+	out.Reset()
+	_, err = Pull(ref, out)
+	ast.Nil(err)
+	ast.Equal(2, strings.Count(out.String(), "Already exists"))
+	ast.Equal(1, reg.blobHits[sha256Digest(lower)])
+	ast.Equal(1, reg.blobHits[sha256Digest(upper)])
+
+	_, err = Pull(reg.host()+"/test/app:missing", io.Discard)
+	ast.NotNil(err)
+}
+
+func TestPullResume(t *testing.T) {
+	ast := assert.New(t)
+	setupStore(t)
+	reg := newFakeRegistry(t)
+	layer := newOrderedTar(t, tarEntry{name: "data", content: strings.Repeat("x", 8192)})
+	reg.pushImage(t, "latest", layer)
+
+	// 模拟上次下载到一半中断
+	dir := filepath.Join(Root(), downloadsDir)
+	ast.Nil(os.MkdirAll(dir, 0700))
+	partial := filepath.Join(dir, digestHex(sha256Digest(layer))+".partial")
+	ast.Nil(os.WriteFile(partial, layer[:4096], 0600))
+
+	_, err := Pull(reg.host()+"/test/app", io.Discard)
+	ast.Nil(err)
+	ast.Equal([]string{"bytes=4096-"}, reg.ranges)
+	_, err = GetLayer(sha256Digest(layer))
+	ast.Nil(err)
+	_, err = os.Stat(partial)
+	ast.True(os.IsNotExist(err))
+}
+
+func TestPullDigestMismatch(t *testing.T) {
+	ast := assert.New(t)
+	setupStore(t)
+	reg := newFakeRegistry(t)
+	layer := newOrderedTar(t, tarEntry{name: "data", content: "data"})
+	reg.pushImage(t, "latest", layer)
+	digest := sha256Digest(layer)
+	reg.blobs[digest] = newOrderedTar(t, tarEntry{name: "data", content: "evil"})
+
+	_, err := Pull(reg.host()+"/test/app:latest", io.Discard)
+	ast.NotNil(err)
+	_, err = GetLayer(digest)
+	ast.NotNil(err)
+	_, err = os.Stat(filepath.Join(Root(), downloadsDir, digestHex(digest)+".partial"))
+	ast.True(os.IsNotExist(err))
+	_, err = Resolve(reg.host() + "/test/app:latest")
+	ast.NotNil(err)
+}
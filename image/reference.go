@@ -0,0 +1,181 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// nameRegexp 镜像名，可以带 registry 地址，例如 busybox、library/busybox、localhost:5000/library/busybox
+	nameRegexp = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?(:[0-9]+)?/)?[a-z0-9]+([._-][a-z0-9]+)*(/[a-z0-9]+([._-][a-z0-9]+)*)*$`)
+	// tagRegexp 镜像 tag
+	tagRegexp = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+)
+
+// ParseReference 解析镜像名，返回 name 和 tag，没有 tag 时使用 latest
+func ParseReference(ref string) (string, string, error) {
+	name, tag := ref, DefaultTag
+	// 最后一个冒号之后没有 / 时才是 tag，否则是 registry 的端口
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		name, tag = ref[:i], ref[i+1:]
+	}
+	if !nameRegexp.MatchString(name) {
+		return "", "", fmt.Errorf("invalid reference format: %s", ref)
+	}
+	if !tagRegexp.MatchString(tag) {
+		return "", "", fmt.Errorf("invalid tag format: %s", ref)
+	}
+	return name, tag, nil
+}
+
+// NormalizeReference 把镜像名规范为 name:tag 的形式
+func NormalizeReference(ref string) (string, error) {
+	name, tag, err := ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+	return name + ":" + tag, nil
+}
+
+// repositories 镜像名到镜像Id的索引，key 为 name:tag
+type repositories map[string]string
+
+func readRepositories() (repositories, error) {
+	repos := make(repositories)
+	content, err := os.ReadFile(filepath.Join(root, repositoriesName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return repos, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &repos); err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+func (repos repositories) write() error {
+	content, err := json.MarshalIndent(repos, "", "    ")
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再 rename，避免写到一半时索引损坏
+	tmp := filepath.Join(root, repositoriesName+".tmp")
+	if err = os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(root, repositoriesName))
+}
+
+// Tag 把镜像名指向镜像，镜像名已经存在时指向新的镜像
+func Tag(ref, imageId string) error {
+	normalized, err := NormalizeReference(ref)
+	if err != nil {
+		return err
+	}
+	return withLock(func() error {
+		if _, err := os.Stat(imageContentPath(imageId)); err != nil {
+			return fmt.Errorf("no such image: %s", imageId)
+		}
+		repos, err := readRepositories()
+		if err != nil {
+			return err
+		}
+		repos[normalized] = imageId
+		return repos.write()
+	})
+}
+
+// Untag 删除镜像名，返回镜像名原来指向的镜像Id
+func Untag(ref string) (string, error) {
+	normalized, err := NormalizeReference(ref)
+	if err != nil {
+		return "", err
+	}
+	var imageId string
+	err = withLock(func() error {
+		repos, err := readRepositories()
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if imageId, ok = repos[normalized]; !ok {
+			return fmt.Errorf("no such image: %s", ref)
+		}
+		delete(repos, normalized)
+		return repos.write()
+	})
+	return imageId, err
+}
+
+// References 获取指向镜像的所有镜像名
+func References(imageId string) ([]string, error) {
+	repos, err := readRepositories()
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for ref, id := range repos {
+		if id == imageId {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// removeReferences 删除指向镜像的所有镜像名，调用方需要持有镜像存储的锁
+func removeReferences(imageId string) error {
+	repos, err := readRepositories()
+	if err != nil {
+		return err
+	}
+	for ref, id := range repos {
+		if id == imageId {
+			delete(repos, ref)
+		}
+	}
+	return repos.write()
+}
+
+// Resolve 根据镜像名、完整的镜像Id或者唯一的镜像Id前缀找到镜像Id
+func Resolve(ref string) (string, error) {
+	if normalized, err := NormalizeReference(ref); err == nil {
+		repos, err := readRepositories()
+		if err != nil {
+			return "", err
+		}
+		if imageId, ok := repos[normalized]; ok {
+			return imageId, nil
+		}
+	}
+
+	prefix := digestHex(ref)
+	if len(prefix) == 0 {
+		return "", fmt.Errorf("no such image: %s", ref)
+	}
+	imageIds, err := List()
+	if err != nil {
+		return "", err
+	}
+	var matched []string
+	for _, imageId := range imageIds {
+		if strings.HasPrefix(digestHex(imageId), prefix) {
+			matched = append(matched, imageId)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return "", fmt.Errorf("no such image: %s", ref)
+	case 1:
+		return matched[0], nil
+	default:
+		return "", fmt.Errorf("image id prefix %s is ambiguous", ref)
+	}
+}
@@ -0,0 +1,29 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReference(t *testing.T) {
+	ast := assert.New(t)
+
+	for ref, want := range map[string][2]string{
+		"busybox":                       {"busybox", "latest"},
+		"busybox:1.36":                  {"busybox", "1.36"},
+		"library/busybox:musl":          {"library/busybox", "musl"},
+		"localhost:5000/busybox":        {"localhost:5000/busybox", "latest"},
+		"registry.io:5000/a/b-c:v1.0_1": {"registry.io:5000/a/b-c", "v1.0_1"},
+	} {
+		name, tag, err := ParseReference(ref)
+		ast.Nil(err, ref)
+		ast.Equal(want[0], name, ref)
+		ast.Equal(want[1], tag, ref)
+	}
+
+	for _, ref := range []string{"", "Busybox", "busybox:", "busybox:-1", "../busybox", "busy//box", "busybox:a:b"} {
+		_, _, err := ParseReference(ref)
+		ast.NotNil(err, ref)
+	}
+}
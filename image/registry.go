@@ -0,0 +1,323 @@
+package image
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultRegistry 镜像名没有 registry 地址时使用 docker hub
+	defaultRegistry = "registry-1.docker.io"
+	// officialRepoPrefix docker hub 官方镜像的仓库前缀
+	officialRepoPrefix = "library/"
+	// maxManifestSize manifest 的最大长度
+	maxManifestSize = 4 << 20
+	// downloadRetries 下载 blob 失败后的重试次数，重试时从已经下载的位置继续
+	downloadRetries = 3
+)
+
+// manifestAcceptTypes 拉取 manifest 时支持的 media type
+var manifestAcceptTypes = []string{
+	MediaTypeOCIIndex,
+	MediaTypeOCIManifest,
+	MediaTypeDockerManifestList,
+	MediaTypeDockerManifest,
+}
+
+// authParamRegexp 解析 WWW-Authenticate 中的 key="value"
+var authParamRegexp = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// registryClient OCI distribution 协议的客户端，一个客户端只访问一个仓库
+type registryClient struct {
+	client *http.Client
+	scheme string
+	host   string
+	repo   string
+
+	mu    sync.Mutex
+	token string
+}
+
+// splitRepository 把镜像名拆分为 registry 地址和仓库名
+// busybox -> registry-1.docker.io, library/busybox
+// localhost:5000/foo/bar -> localhost:5000, foo/bar
+func splitRepository(name string) (string, string) {
+	host, repo, found := strings.Cut(name, "/")
+	if !found || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		host, repo = defaultRegistry, name
+		if !strings.Contains(repo, "/") {
+			repo = officialRepoPrefix + repo
+		}
+	}
+	if host == "docker.io" || host == "index.docker.io" {
+		host = defaultRegistry
+	}
+	return host, repo
+}
+
+// registryScheme 本机的 registry 使用 http，其他 registry 使用 https
+func registryScheme(host string) string {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" {
+		return "http"
+	}
+	if ip := net.ParseIP(hostname); ip != nil && ip.IsLoopback() {
+		return "http"
+	}
+	return "https"
+}
+
+func newRegistryClient(host, repo string) *registryClient {
+	return &registryClient{
+		client: &http.Client{Timeout: 30 * time.Minute},
+		scheme: registryScheme(host),
+		host:   host,
+		repo:   repo,
+	}
+}
+
+// do 发送请求，registry 返回 401 时按照 WWW-Authenticate 获取 token 后重试一次
+func (c *registryClient) do(method, path string, header http.Header) (*http.Response, error) {
+	target := fmt.Sprintf("%s://%s/v2/%s/%s", c.scheme, c.host, c.repo, path)
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		c.mu.Lock()
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		c.mu.Unlock()
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		_ = resp.Body.Close()
+		if err = c.authorize(challenge); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// authorize 根据 WWW-Authenticate 中的 realm、service 和 scope 获取匿名的 bearer token
+func (c *registryClient) authorize(challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return fmt.Errorf("unsupported registry auth challenge %q", challenge)
+	}
+	values := make(map[string]string)
+	for _, match := range authParamRegexp.FindAllStringSubmatch(params, -1) {
+		values[strings.ToLower(match[1])] = match[2]
+	}
+	realm, err := url.Parse(values["realm"])
+	if err != nil || realm.Host == "" {
+		return fmt.Errorf("invalid auth realm in %q", challenge)
+	}
+	query := realm.Query()
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	scope := values["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", c.repo)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	resp, err := c.client.Get(realm.String())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("get registry token from %s error, status %s", realm.Host, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	if c.token == "" {
+		return fmt.Errorf("registry token is empty")
+	}
+	return nil
+}
+
+// getManifest 拉取 manifest 或者 index，reference 可以是 tag 或者摘要，返回内容、media type 和摘要
+func (c *registryClient) getManifest(reference string) ([]byte, string, string, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join(manifestAcceptTypes, ", "))
+	resp, err := c.do(http.MethodGet, "manifests/"+reference, header)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", "", fmt.Errorf("get manifest %s:%s error, status %s", c.repo, reference, resp.Status)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	sum := sha256.Sum256(content)
+	digest := digestAlgorithm + ":" + hex.EncodeToString(sum[:])
+	expected := resp.Header.Get("Docker-Content-Digest")
+	if strings.HasPrefix(reference, digestAlgorithm+":") {
+		expected = reference
+	}
+	if expected != "" && expected != digest {
+		return nil, "", "", fmt.Errorf("manifest digest mismatch, expected %s, got %s", expected, digest)
+	}
+
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	var versioned struct {
+		MediaType string `json:"mediaType"`
+		Manifests []any  `json:"manifests"`
+	}
+	if err = json.Unmarshal(content, &versioned); err != nil {
+		return nil, "", "", fmt.Errorf("parse manifest error, %v", err)
+	}
+	if versioned.MediaType != "" {
+		mediaType = versioned.MediaType
+	} else if versioned.Manifests != nil {
+		mediaType = MediaTypeOCIIndex
+	}
+	return content, mediaType, digest, nil
+}
+
+// getBlob 把 blob 读到内存中并检查摘要，用于镜像配置等小文件
+func (c *registryClient) getBlob(desc Descriptor) ([]byte, error) {
+	if err := ValidateDigest(desc.Digest); err != nil {
+		return nil, err
+	}
+	resp, err := c.do(http.MethodGet, "blobs/"+desc.Digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get blob %s error, status %s", desc.Digest, resp.Status)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	if digest := digestAlgorithm + ":" + hex.EncodeToString(sum[:]); digest != desc.Digest {
+		return nil, fmt.Errorf("blob digest mismatch, expected %s, got %s", desc.Digest, digest)
+	}
+	return content, nil
+}
+
+// downloadBlob 把 blob 下载到 dest 并检查摘要
+// 下载中的数据保存在 dest.partial 中，中断后再次下载时通过 Range 请求从已经下载的位置继续
+func (c *registryClient) downloadBlob(desc Descriptor, dest string) error {
+	if err := ValidateDigest(desc.Digest); err != nil {
+		return err
+	}
+	if _, err := os.Stat(dest); err == nil {
+		return nil
+	}
+	partial := dest + ".partial"
+	var err error
+	for attempt := 0; attempt < downloadRetries; attempt++ {
+		if err = c.downloadPartial(desc, partial); err == nil {
+			break
+		}
+		logrus.Warnf("download blob %s error, %v, retry", desc.Digest, err)
+	}
+	if err != nil {
+		return err
+	}
+	if err = verifyFile(partial, desc.Digest); err != nil {
+		// 数据已经损坏，下次从头下载
+		_ = os.Remove(partial)
+		return err
+	}
+	return os.Rename(partial, dest)
+}
+
+func (c *registryClient) downloadPartial(desc Descriptor, partial string) error {
+	file, err := os.OpenFile(partial, os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if desc.Size > 0 && offset >= desc.Size {
+		return nil
+	}
+
+	header := http.Header{}
+	if offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := c.do(http.MethodGet, "blobs/"+desc.Digest, header)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		logrus.Infof("resume blob %s from %d", desc.Digest, offset)
+	case http.StatusOK:
+		// registry 不支持 Range 时从头下载
+		if err = file.Truncate(0); err != nil {
+			return err
+		}
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("get blob %s error, status %s", desc.Digest, resp.Status)
+	}
+	_, err = io.Copy(file, resp.Body)
+	return err
+}
@@ -0,0 +1,62 @@
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// root 镜像存储的根目录
+var root = DefaultRoot
+
+// SetRoot 修改镜像存储的根目录，为空时使用默认目录
+func SetRoot(dir string) {
+	if dir == "" {
+		dir = DefaultRoot
+	}
+	root = dir
+}
+
+// Root 获取镜像存储的根目录
+func Root() string {
+	return root
+}
+
+func layerDir(diffId string) string {
+	return filepath.Join(root, layersDir, digestAlgorithm, digestHex(diffId))
+}
+
+func imageContentPath(imageId string) string {
+	return filepath.Join(root, imageContentDir, digestAlgorithm, digestHex(imageId))
+}
+
+func imageMetadataPath(imageId string) string {
+	return filepath.Join(root, imageMetadataDir, digestAlgorithm, digestHex(imageId))
+}
+
+// digestHex 去掉摘要的算法前缀，sha256:abc -> abc
+func digestHex(digest string) string {
+	return strings.TrimPrefix(digest, digestAlgorithm+":")
+}
+
+// withLock 对整个镜像存储加文件锁后执行 fn，保证层、镜像和索引的修改互斥
+func withLock(fn func() error) error {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return err
+	}
+	lockFile, err := os.OpenFile(filepath.Join(root, lockName), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = lockFile.Close()
+	}()
+	if err = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer func() {
+		_ = syscall.Flock(int(lockFile.Fd()), syscall.LOCK_UN)
+	}()
+	return fn()
+}
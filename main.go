@@ -9,6 +9,7 @@ import (
 
 	// 需要导入nsenter包，以触发C代码
 	"github.com/pjimming/mydocker/command"
+	"github.com/pjimming/mydocker/image"
 	_ "github.com/pjimming/mydocker/nsenter"
 )
 
@@ -21,16 +22,41 @@ func main() {
 	app.Name = "mydocker"
 	app.Usage = usage
 
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "image-root",
+			Usage:  "root directory of the image store",
+			Value:  image.DefaultRoot,
+			EnvVar: image.EnvImageRoot,
+		},
+	}
+
 	app.Commands = []cli.Command{
 		command.InitCommand,
+		command.MonitorCommand,
 		command.CommitCommand,
+		command.LoadCommand,
+		command.ImportCommand,
+		command.ExportCommand,
+		command.CpCommand,
+		command.ChrootArchiveCommand,
+		command.DiffCommand,
+		command.PullCommand,
+		command.ImagesCommand,
+		command.RmiCommand,
+		command.TagCommand,
 		command.ExecCommand,
+		command.InspectCommand,
 		command.ListCommand,
 		command.RemoveCommand,
 		command.LogCommand,
 		command.RunCommand,
+		command.StartCommand,
+		command.RestartCommand,
 		command.StopCommand,
+		command.KillCommand,
 		command.NetworkCommand,
+		command.VolumeCommand,
 	}
 
 	app.Before = func(ctx *cli.Context) error {
@@ -40,7 +66,10 @@ func main() {
 		})
 		logrus.SetOutput(os.Stdout)
 		logrus.SetLevel(logrus.DebugLevel)
-		return nil
+
+		// monitor 等子进程通过环境变量继承镜像存储的根目录
+		image.SetRoot(ctx.GlobalString("image-root"))
+		return os.Setenv(image.EnvImageRoot, image.Root())
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -4,8 +4,6 @@ import (
 	"errors"
 	"fmt"
 	"net"
-	"os/exec"
-	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -42,7 +40,15 @@ func (d *BridgeNetworkDriver) Delete(network Network) error {
 		return err
 	}
 	// 删除网络对应的 Lin ux Bridge 设备
-	return netlink.LinkDel(br)
+	if err = netlink.LinkDel(br); err != nil {
+		return err
+	}
+	// 删除创建网络时添加的 MASQUERADE 规则
+	_, subnet, err := net.ParseCIDR(network.IpRange.String())
+	if err != nil {
+		return err
+	}
+	return delNatRule(masqueradeRule(network.Name, subnet))
 }
 
 // Connect 连接一个网络和网络端点
@@ -74,13 +80,25 @@ func (d *BridgeNetworkDriver) Connect(network *Network, endpoint *Endpoint) erro
 	// 调用netlink的LinkSetUp方法，设置Veth启动
 	// 相当于ip link set xxx up命令
 	if err = netlink.LinkSetUp(&endpoint.Device); err != nil {
+		_ = netlink.LinkDel(&endpoint.Device)
 		return fmt.Errorf("error Add Endpoint Device: %v", err)
 	}
 	return nil
 }
 
+// Disconnect 删除网络端点在宿主机上的 Veth 设备
+// 删除 Veth 的一端时另一端也会被一起删除，容器退出后 Net Namespace 销毁时 Veth 也会被内核回收，
+// 因此设备已经不存在时直接返回
 func (d *BridgeNetworkDriver) Disconnect(network Network, endpoint *Endpoint) error {
-	return nil
+	veth, err := netlink.LinkByName(endpoint.Device.Name)
+	if err != nil {
+		if errors.As(err, &netlink.LinkNotFoundError{}) {
+			return nil
+		}
+		return err
+	}
+	// 相当于 ip link del xxx 命令
+	return netlink.LinkDel(veth)
 }
 
 // initBridge 初始化Linux Bridge
@@ -89,7 +107,7 @@ Linux Bridge 初始化流程如下：
 * 1）创建 Bridge 虚拟设备
 * 2）设置 Bridge 设备地址和路由
 * 3）启动 Bridge 设备
-* 4）设置 iptables SNAT 规则
+* 4）设置 SNAT 规则
 */
 func (d *BridgeNetworkDriver) initBridge(n *Network) error {
 	bridgeName := n.Name
@@ -110,8 +128,8 @@ func (d *BridgeNetworkDriver) initBridge(n *Network) error {
 		return err
 	}
 
-	// 4）设置 iptables SNAT 规则
-	if err := setupIPTables(bridgeName, n.IpRange); err != nil {
+	// 4）设置 SNAT 规则
+	if err := setupNAT(bridgeName, n.IpRange); err != nil {
 		return err
 	}
 
@@ -122,8 +140,8 @@ func (d *BridgeNetworkDriver) initBridge(n *Network) error {
 // ip link add xxxx
 func createBridgeInterface(bridgeName string) error {
 	// 先检查是否己经存在了这个同名的Bridge设备
-	if _, err := net.InterfaceByName(bridgeName); err == nil || !errors.Is(err, errNoSuchInterface) {
-		logrus.Errorf("[createBridgeInterface] net.InterfaceByName error, %v", err)
+	if _, err := netlink.LinkByName(bridgeName); err == nil || !errors.As(err, &netlink.LinkNotFoundError{}) {
+		logrus.Errorf("[createBridgeInterface] netlink.LinkByName error, %v", err)
 		return err
 	}
 
@@ -186,18 +204,17 @@ func setInterfaceUP(interfaceName string) error {
 	return nil
 }
 
-// setupIPTables 设置 iptables 对应 bridge MASQUERADE 规则
-// iptables -t nat -A POSTROUTING -s 172.18.0.0/24 -o eth0 -j MASQUERADE
-// iptables -t nat -A POSTROUTING -s {subnet} -o {deviceName} -j MASQUERADE
-func setupIPTables(bridgeName string, subnet *net.IPNet) error {
-	// 拼接命令
-	iptablesCmd := fmt.Sprintf("-t nat -A POSTROUTING -s %s ! -o %s -j MASQUERADE", subnet.String(), bridgeName)
-	cmd := exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
-	// 执行该命令
-	output, err := cmd.Output()
+// setupNAT 设置 bridge 网段的 MASQUERADE 规则，容器访问外部网络时把源地址转换为宿主机出口网卡的地址
+// 相当于 iptables -t nat -A POSTROUTING -s {subnet} ! -o {bridgeName} -j MASQUERADE
+func setupNAT(bridgeName string, subnet *net.IPNet) error {
+	_, ipNet, err := net.ParseCIDR(subnet.String())
+	if err != nil {
+		return err
+	}
+	rule, err := addMasquerade(bridgeName, ipNet)
 	if err != nil {
-		logrus.Errorf("iptables Output, %v", output)
 		return err
 	}
+	logrus.Infof("add masquerade rule: %s", rule)
 	return nil
 }
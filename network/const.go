@@ -3,5 +3,7 @@ package network
 const (
 	ipamDefaultAllocatorPath = "/var/run/mydocker/network/ipam/subnet.json"
 	defaultNetworkPath       = "/var/run/mydocker/network/network/"
-	retries                  = 3
+	// defaultEndpointPath 网络端点记录了需要回收的IP、Veth设备和端口映射规则，保存在磁盘上，宿主机重启后也能断开连接
+	defaultEndpointPath = "/var/lib/mydocker/network/endpoint/"
+	retries             = 3
 )
@@ -2,6 +2,7 @@ package network
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"net"
 	"os"
@@ -75,14 +76,25 @@ func (ipam *IPAM) Release(subnet *net.IPNet, ipAddr *net.IP) error {
 		return err
 	}
 	// 和分配一样的算法，反过来根据IP找到位图数组中的对应索引位置
+	// 拷贝一份IP再做计算，避免修改调用方传入的地址
 	c := 0
-	releaseIP := ipAddr.To4()
+	releaseIP := make(net.IP, net.IPv4len)
+	copy(releaseIP, ipAddr.To4())
 	releaseIP[3] -= 1
 	for t := uint(4); t > 0; t -= 1 {
 		c += int(releaseIP[t-1]-subnet.IP[t-1]) << ((4 - t) * 8)
 	}
 	// 然后将对应位置0
-	ipAlloc := []byte((*ipam.Subnets)[subnet.String()])
+	// 网段的分配记录不存在时（比如宿主机重启后），说明这个IP已经不再占用
+	allocated, ok := (*ipam.Subnets)[subnet.String()]
+	if !ok {
+		logrus.Infof("[Release] subnet %s not allocated, skip", subnet.String())
+		return nil
+	}
+	ipAlloc := []byte(allocated)
+	if c < 0 || c >= len(ipAlloc) {
+		return fmt.Errorf("ip %s not allocated in subnet %s", ipAddr.String(), subnet.String())
+	}
 	ipAlloc[c] = '0'
 	(*ipam.Subnets)[subnet.String()] = string(ipAlloc)
 
@@ -2,6 +2,7 @@ package network
 
 import (
 	"net"
+	"path"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,3 +20,20 @@ func TestIPAM_Allocate(t *testing.T) {
 	assert.Nil(t, err)
 	t.Logf("allocate ip: %s", ip.String())
 }
+
+func TestIPAM_ReleaseUnknownSubnet(t *testing.T) {
+	ast := assert.New(t)
+	ipam := &IPAM{SubnetAllocatorPath: path.Join(t.TempDir(), "subnet.json")}
+	_, ipNet, _ := net.ParseCIDR("10.10.0.0/24")
+	ip := net.ParseIP("10.10.0.2")
+	// 网段的分配记录不存在时不需要释放
+	ast.Nil(ipam.Release(ipNet, &ip))
+
+	allocated, err := ipam.Allocate(ipNet)
+	ast.Nil(err)
+	ast.Nil(ipam.Release(ipNet, &allocated))
+	// 释放后可以重新分配到同一个IP
+	again, err := ipam.Allocate(ipNet)
+	ast.Nil(err)
+	ast.Equal(allocated.String(), again.String())
+}
@@ -0,0 +1,203 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"golang.org/x/sys/unix"
+)
+
+/*
+通过 netlink 直接操作 nftables，不再依赖宿主机上的 iptables 命令
+所有规则都放在 ip mydocker 表中，相当于：
+table ip mydocker {
+	chain prerouting { type nat hook prerouting priority dstnat; }
+	chain postrouting { type nat hook postrouting priority srcnat; }
+}
+每条规则的 UserData 中保存规则的描述，删除时根据描述找到规则的 handle
+*/
+
+const (
+	natTableName       = "mydocker"
+	natPreroutingName  = "prerouting"
+	natPostroutingName = "postrouting"
+)
+
+var (
+	natTable = &nftables.Table{Family: nftables.TableFamilyIPv4, Name: natTableName}
+	// natPrerouting 目的地址转换，用于端口映射
+	natPrerouting = &nftables.Chain{
+		Name:     natPreroutingName,
+		Table:    natTable,
+		Type:     nftables.ChainTypeNAT,
+		Hooknum:  nftables.ChainHookPrerouting,
+		Priority: nftables.ChainPriorityNATDest,
+	}
+	// natPostrouting 源地址转换，用于容器访问外部网络
+	natPostrouting = &nftables.Chain{
+		Name:     natPostroutingName,
+		Table:    natTable,
+		Type:     nftables.ChainTypeNAT,
+		Hooknum:  nftables.ChainHookPostrouting,
+		Priority: nftables.ChainPriorityNATSource,
+	}
+)
+
+// masqueradeRule 规则描述，例如 POSTROUTING -s 172.18.0.0/24 ! -o testbr -j MASQUERADE
+func masqueradeRule(bridgeName string, subnet *net.IPNet) string {
+	return fmt.Sprintf("POSTROUTING -s %s ! -o %s -j MASQUERADE", subnet.String(), bridgeName)
+}
+
+// dnatRule 规则描述，例如 PREROUTING -p tcp --dport 8080 -j DNAT --to-destination 172.18.0.2:80
+func dnatRule(hostPort uint16, ip net.IP, containerPort uint16) string {
+	return fmt.Sprintf("PREROUTING -p tcp --dport %d -j DNAT --to-destination %s:%d", hostPort, ip.String(), containerPort)
+}
+
+// addMasquerade 对从 bridge 网段发出、不是发往 bridge 的数据包做 SNAT
+// nft add rule ip mydocker postrouting ip saddr {subnet} oifname != {bridge} masquerade
+func addMasquerade(bridgeName string, subnet *net.IPNet) (string, error) {
+	ip := subnet.IP.To4()
+	if ip == nil {
+		return "", fmt.Errorf("subnet %s is not an IPv4 network", subnet)
+	}
+	rule := masqueradeRule(bridgeName, subnet)
+	exprs := []expr.Any{
+		// ip saddr & mask == subnet
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: 12, Len: 4},
+		&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: 4, Mask: []byte(subnet.Mask), Xor: make([]byte, 4)},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte(ip.Mask(subnet.Mask))},
+		// oifname != bridge
+		&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: ifname(bridgeName)},
+		&expr.Masq{},
+	}
+	return rule, addNatRule(natPostrouting, rule, exprs)
+}
+
+// addDNAT 把发往宿主机端口的 tcp 数据包转发到容器的地址和端口
+// nft add rule ip mydocker prerouting tcp dport {hostPort} dnat to {ip}:{containerPort}
+func addDNAT(hostPort uint16, ip net.IP, containerPort uint16) (string, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return "", fmt.Errorf("%s is not an IPv4 address", ip)
+	}
+	rule := dnatRule(hostPort, ip, containerPort)
+	exprs := []expr.Any{
+		// meta l4proto tcp
+		&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{unix.IPPROTO_TCP}},
+		// tcp dport == hostPort
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 2, Len: 2},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: port(hostPort)},
+		&expr.Immediate{Register: 1, Data: []byte(ip4)},
+		&expr.Immediate{Register: 2, Data: port(containerPort)},
+		&expr.NAT{
+			Type:        expr.NATTypeDestNAT,
+			Family:      unix.NFPROTO_IPV4,
+			RegAddrMin:  1,
+			RegProtoMin: 2,
+		},
+	}
+	return rule, addNatRule(natPrerouting, rule, exprs)
+}
+
+// addNatRule 添加规则，表和链不存在时一起创建，整个过程在一个事务中完成
+func addNatRule(chain *nftables.Chain, rule string, exprs []expr.Any) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return fmt.Errorf("open nftables connection error, %w", err)
+	}
+	conn.AddTable(natTable)
+	conn.AddChain(natPrerouting)
+	conn.AddChain(natPostrouting)
+	conn.AddRule(&nftables.Rule{
+		Table:    natTable,
+		Chain:    chain,
+		Exprs:    exprs,
+		UserData: []byte(rule),
+	})
+	if err = conn.Flush(); err != nil {
+		return fmt.Errorf("add nat rule %q error, %w", rule, err)
+	}
+	return nil
+}
+
+// delNatRule 根据规则描述删除规则，规则或者表不存在时直接返回
+func delNatRule(rule string) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return fmt.Errorf("open nftables connection error, %w", err)
+	}
+	if _, err = conn.ListTableOfFamily(natTableName, natTable.Family); err != nil {
+		return nil
+	}
+	deleted := false
+	for _, chain := range []*nftables.Chain{natPrerouting, natPostrouting} {
+		rules, err := conn.GetRules(natTable, chain)
+		if err != nil {
+			continue
+		}
+		for _, r := range rules {
+			if string(r.UserData) != rule {
+				continue
+			}
+			if err = conn.DelRule(r); err != nil {
+				return fmt.Errorf("delete nat rule %q error, %w", rule, err)
+			}
+			deleted = true
+		}
+	}
+	if !deleted {
+		return nil
+	}
+	if err = conn.Flush(); err != nil {
+		return fmt.Errorf("delete nat rule %q error, %w", rule, err)
+	}
+	return nil
+}
+
+// ValidatePortMapping 检查端口映射的格式，在启动容器之前发现错误
+func ValidatePortMapping(portMapping []string) error {
+	for _, pm := range portMapping {
+		if _, _, err := parsePortMapping(pm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parsePortMapping 解析端口映射，格式为 宿主机端口:容器端口
+func parsePortMapping(pm string) (uint16, uint16, error) {
+	hostPort, containerPort, ok := strings.Cut(pm, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid port mapping %s, expected hostPort:containerPort", pm)
+	}
+	host, err := strconv.ParseUint(hostPort, 10, 16)
+	if err != nil || host == 0 {
+		return 0, 0, fmt.Errorf("invalid host port in port mapping %s", pm)
+	}
+	ctr, err := strconv.ParseUint(containerPort, 10, 16)
+	if err != nil || ctr == 0 {
+		return 0, 0, fmt.Errorf("invalid container port in port mapping %s", pm)
+	}
+	return uint16(host), uint16(ctr), nil
+}
+
+// port 端口号使用网络字节序
+func port(p uint16) []byte {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, p)
+	return b
+}
+
+// ifname 网卡名在内核中是以 \0 结尾、长度为 IFNAMSIZ 的字节数组
+func ifname(name string) []byte {
+	b := make([]byte, unix.IFNAMSIZ)
+	copy(b, name)
+	return b
+}
@@ -0,0 +1,36 @@
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePortMapping(t *testing.T) {
+	ast := assert.New(t)
+
+	hostPort, containerPort, err := parsePortMapping("8080:80")
+	ast.Nil(err)
+	ast.Equal(uint16(8080), hostPort)
+	ast.Equal(uint16(80), containerPort)
+
+	for _, pm := range []string{"8080", "8080:", ":80", "0:80", "65536:80", "a:80", "8080:80:1"} {
+		_, _, err = parsePortMapping(pm)
+		ast.NotNil(err, pm)
+	}
+
+	ast.Nil(ValidatePortMapping([]string{"8080:80", "8443:443"}))
+	ast.NotNil(ValidatePortMapping([]string{"8080:80", "8080:80x"}))
+}
+
+func TestNatRule(t *testing.T) {
+	ast := assert.New(t)
+
+	_, subnet, _ := net.ParseCIDR("172.18.0.1/24")
+	ast.Equal("POSTROUTING -s 172.18.0.0/24 ! -o testbr -j MASQUERADE", masqueradeRule("testbr", subnet))
+	ast.Equal("PREROUTING -p tcp --dport 8080 -j DNAT --to-destination 172.18.0.2:80",
+		dnatRule(8080, net.ParseIP("172.18.0.2"), 80))
+	ast.Equal([]byte{0x1f, 0x90}, port(8080))
+	ast.Len(ifname("testbr"), 16)
+}
@@ -2,15 +2,14 @@ package network
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
 	"net"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 	"text/tabwriter"
 
 	"github.com/sirupsen/logrus"
@@ -21,9 +20,8 @@ import (
 )
 
 var (
-	errNoSuchInterface = errors.New("no such network interface")
-	networks           = map[string]*Network{}
-	drivers            = map[string]Driver{}
+	networks = map[string]*Network{}
+	drivers  = map[string]Driver{}
 )
 
 type Network struct {
@@ -37,8 +35,9 @@ type Endpoint struct {
 	Device      netlink.Veth     `json:"dev"`
 	IPAddress   net.IP           `json:"ip"`
 	MacAddress  net.HardwareAddr `json:"mac"`
-	Network     *Network
-	PortMapping []string
+	Network     *Network         `json:"network"`
+	PortMapping []string         `json:"portMapping"`
+	PortRules   []string         `json:"portRules"` // 已添加到 nat 表的 DNAT 规则描述，断开连接时据此删除
 }
 
 type Driver interface {
@@ -110,6 +109,34 @@ func (nw *Network) load(dumpPath string) error {
 	return err
 }
 
+func (ep *Endpoint) dump(dumpPath string) error {
+	if err := os.MkdirAll(dumpPath, 0644); err != nil {
+		return err
+	}
+	// 保存的文件名是网络端点的ID
+	epPath := path.Join(dumpPath, ep.ID)
+	epJson, err := json.Marshal(ep)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(epPath, epJson, 0644)
+}
+
+func (ep *Endpoint) remove(dumpPath string) error {
+	if err := os.Remove(path.Join(dumpPath, ep.ID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (ep *Endpoint) load(dumpPath string) error {
+	epJson, err := os.ReadFile(path.Join(dumpPath, ep.ID))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(epJson, ep)
+}
+
 func Init() error {
 	// 加载网络驱动
 	var bridgeDriver = BridgeNetworkDriver{}
@@ -301,45 +328,57 @@ func configEndpointIpAddressAndRoute(ep *Endpoint, info *container.Info) error {
 }
 
 // configPortMapping 配置端口映射
+// 任何一条规则添加失败都返回错误，已经添加的规则记录在 PortRules 中，由调用方回收
 func configPortMapping(ep *Endpoint) error {
-	var err error
 	// 遍历容器端口映射列表
 	for _, pm := range ep.PortMapping {
 		// 分割成宿主机的端口和容器的端口
-		portMapping := strings.Split(pm, ":")
-		if len(portMapping) != 2 {
-			logrus.Errorf("port mapping format error, %v", pm)
-			continue
+		hostPort, containerPort, err := parsePortMapping(pm)
+		if err != nil {
+			return err
 		}
-		// 由于iptables没有Go语言版本的实现，所以采用exec.Command的方式直接调用命令配置
-		// 在iptables的PREROUTING中添加DNAT规则
+		// 在 nat 表的 prerouting 链中添加 DNAT 规则
 		// 将宿主机的端口请求转发到容器的地址和端口上
-		iptablesCmd := fmt.Sprintf("-t nat -A PREROUTING -p tcp -m tcp --dport %s -j DNAT --to-destination %s:%s",
-			portMapping[0], ep.IPAddress.String(), portMapping[1])
-		cmd := exec.Command("iptables", strings.Split(iptablesCmd, " ")...)
-		logrus.Infoln("配置端口映射 cmd:", cmd.String())
-		// 执行iptables命令,添加端口映射转发规则
-		output, err := cmd.Output()
+		rule, err := addDNAT(hostPort, ep.IPAddress, containerPort)
 		if err != nil {
-			logrus.Errorf("iptables Output, %v", output)
-			continue
+			return fmt.Errorf("add port mapping %s error, %w", pm, err)
 		}
+		logrus.Infof("add port mapping rule: %s", rule)
+		// 记录添加成功的规则，断开连接时删除
+		ep.PortRules = append(ep.PortRules, rule)
 	}
-	return err
+	return nil
+}
+
+// deletePortMapping 删除网络端点添加过的端口映射规则，删除失败的规则留在 ep.PortRules 中
+func deletePortMapping(ep *Endpoint) error {
+	var errMsg []string
+	var remain []string
+	for _, rule := range ep.PortRules {
+		if err := delNatRule(rule); err != nil {
+			errMsg = append(errMsg, err.Error())
+			remain = append(remain, rule)
+		}
+	}
+	ep.PortRules = remain
+	if len(errMsg) > 0 {
+		return fmt.Errorf("%s", strings.Join(errMsg, ", "))
+	}
+	return nil
 }
 
 // Connect 连接容器到之前创建的网络 mydocker run -net testnet -p 8080:80 xxxx
-func Connect(networkName string, info *container.Info) error {
+func Connect(networkName string, info *container.Info) (net.IP, error) {
 	// 从networks字典中取到容器连接的网络的信息，networks字典中保存了当前己经创建的网络
 	network, ok := networks[networkName]
 	if !ok {
-		return fmt.Errorf("no Such Network: %s", networkName)
+		return nil, fmt.Errorf("no Such Network: %s", networkName)
 	}
 
 	// 分配容器IP地址
 	ip, err := ipAllocator.Allocate(network.IpRange)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// 创建网络端点
@@ -349,18 +388,110 @@ func Connect(networkName string, info *container.Info) error {
 		Network:     network,
 		PortMapping: info.PortMapping,
 	}
+	// 任何一步失败都回收已经添加的端口映射规则、Veth设备和IP，此时网络端点的记录还没有保存，调用方无法再清理
+	deviceAdded := false
+	defer func() {
+		if err != nil {
+			rollbackEndpoint(network, ep, deviceAdded)
+		}
+	}()
 	// 调用网络驱动挂载和配置网络端点
 	if err = drivers[network.Driver].Connect(network, ep); err != nil {
-		return err
+		return nil, err
 	}
+	deviceAdded = true
 	// 到容器的namespace配置容器网络设备IP地址
 	if err = configEndpointIpAddressAndRoute(ep, info); err != nil {
-		return err
+		return nil, err
 	}
 	// 配置端口映射信息，例如 mydocker run -p 8080:80
-	return configPortMapping(ep)
+	if err = configPortMapping(ep); err != nil {
+		return nil, err
+	}
+	// 保存网络端点信息，断开连接时据此回收IP、Veth设备和端口映射规则
+	if err = ep.dump(defaultEndpointPath); err != nil {
+		return nil, err
+	}
+	return ip, nil
 }
 
+// rollbackEndpoint 连接失败时回收网络端点已经占用的资源，回收失败只记录日志
+// deviceAdded 为 false 时 Veth 设备没有创建成功，同名的设备可能属于其他容器，不能删除
+func rollbackEndpoint(network *Network, ep *Endpoint, deviceAdded bool) {
+	if err := deletePortMapping(ep); err != nil {
+		logrus.Errorf("[Connect] rollback port mapping of %s fail, %v", ep.ID, err)
+	}
+	if deviceAdded {
+		if err := drivers[network.Driver].Disconnect(*network, ep); err != nil {
+			logrus.Errorf("[Connect] rollback device of %s fail, %v", ep.ID, err)
+		}
+	}
+	if err := ipAllocator.Release(network.IpRange, &ep.IPAddress); err != nil {
+		logrus.Errorf("[Connect] rollback ip of %s fail, %v", ep.ID, err)
+	}
+}
+
+// Disconnect 断开容器与网络的连接
+// 按照网络端点的记录删除端口映射规则、删除 Veth 设备、释放容器 IP，宿主机重启或者网络已经删除后也能断开
+// 某一步失败时继续执行后面的步骤，把已经完成的步骤从记录中去掉后保存，重试时不会重复释放 IP，全部完成后删除记录
+// 容器的监控进程和 stop 等命令可能同时断开连接，因此断开期间对网络端点目录加文件锁
 func Disconnect(networkName string, info *container.Info) error {
-	return nil
+	dir, err := os.Open(defaultEndpointPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer func() {
+		_ = dir.Close()
+	}()
+	if err = syscall.Flock(int(dir.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer func() {
+		_ = syscall.Flock(int(dir.Fd()), syscall.LOCK_UN)
+	}()
+
+	ep := &Endpoint{
+		ID: fmt.Sprintf("%s-%s", info.Id, networkName),
+	}
+	if err = ep.load(defaultEndpointPath); err != nil {
+		if os.IsNotExist(err) {
+			logrus.Infof("[Disconnect] endpoint %s not found, skip", ep.ID)
+			return nil
+		}
+		return err
+	}
+	if ep.Network == nil {
+		return fmt.Errorf("endpoint %s has no network", ep.ID)
+	}
+
+	var errMsg []string
+	if err = deletePortMapping(ep); err != nil {
+		errMsg = append(errMsg, err.Error())
+	}
+	if ep.Device.Name != "" {
+		if driver, ok := drivers[ep.Network.Driver]; !ok {
+			errMsg = append(errMsg, fmt.Sprintf("no such network driver: %s", ep.Network.Driver))
+		} else if err = driver.Disconnect(*ep.Network, ep); err != nil {
+			errMsg = append(errMsg, err.Error())
+		} else {
+			ep.Device = netlink.Veth{}
+		}
+	}
+	if ep.IPAddress != nil {
+		if err = ipAllocator.Release(ep.Network.IpRange, &ep.IPAddress); err != nil {
+			errMsg = append(errMsg, err.Error())
+		} else {
+			ep.IPAddress = nil
+		}
+	}
+	if len(errMsg) > 0 {
+		if err = ep.dump(defaultEndpointPath); err != nil {
+			errMsg = append(errMsg, err.Error())
+		}
+		return fmt.Errorf("%s", strings.Join(errMsg, ", "))
+	}
+	return ep.remove(defaultEndpointPath)
 }
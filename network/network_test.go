@@ -0,0 +1,37 @@
+package network
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+)
+
+func TestEndpoint_DumpLoad(t *testing.T) {
+	ast := assert.New(t)
+	dumpPath := t.TempDir()
+
+	_, ipRange, _ := net.ParseCIDR("192.168.0.1/24")
+	la := netlink.NewLinkAttrs()
+	la.Name = "12345"
+	ep := &Endpoint{
+		ID:          "1234567890-testbr",
+		Device:      netlink.Veth{LinkAttrs: la, PeerName: "cif-12345"},
+		IPAddress:   net.ParseIP("192.168.0.2"),
+		Network:     &Network{Name: "testbr", IpRange: ipRange, Driver: "bridge"},
+		PortMapping: []string{"8080:80"},
+		PortRules:   []string{dnatRule(8080, net.ParseIP("192.168.0.2"), 80)},
+	}
+	ast.Nil(ep.dump(dumpPath))
+
+	loaded := &Endpoint{ID: ep.ID}
+	ast.Nil(loaded.load(dumpPath))
+	ast.Equal(ep.Device.Name, loaded.Device.Name)
+	ast.Equal(ep.Device.PeerName, loaded.Device.PeerName)
+	ast.True(ep.IPAddress.Equal(loaded.IPAddress))
+	ast.Equal(ep.PortRules, loaded.PortRules)
+
+	ast.Nil(loaded.remove(dumpPath))
+	ast.Nil(loaded.remove(dumpPath))
+}
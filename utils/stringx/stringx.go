@@ -1 +1,18 @@
 package stringx
+
+import "fmt"
+
+// sizeUnits 十进制的存储单位
+var sizeUnits = []string{"B", "kB", "MB", "GB", "TB", "PB"}
+
+// HumanSize 把字节数转换为便于阅读的描述，保留 3 位有效数字，例如 4.26MB
+func HumanSize(size int64) string {
+	value := float64(size)
+	unit := 0
+	// 超过 999.5 时保留 3 位有效数字会进位到 1000，直接换成更大的单位
+	for value >= 999.5 && unit < len(sizeUnits)-1 {
+		value /= 1000
+		unit++
+	}
+	return fmt.Sprintf("%.3g%s", value, sizeUnits[unit])
+}
@@ -0,0 +1,17 @@
+package stringx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHumanSize(t *testing.T) {
+	ast := assert.New(t)
+	ast.Equal("0B", HumanSize(0))
+	ast.Equal("999B", HumanSize(999))
+	ast.Equal("1kB", HumanSize(1000))
+	ast.Equal("4.26MB", HumanSize(4261000))
+	ast.Equal("1MB", HumanSize(999999))
+	ast.Equal("1.5GB", HumanSize(1500000000))
+}
@@ -0,0 +1,42 @@
+package timex
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// HumanDuration 把时间间隔转换为便于阅读的描述，例如 3 minutes、About an hour
+func HumanDuration(d time.Duration) string {
+	if seconds := int(d.Seconds()); seconds < 1 {
+		return "Less than a second"
+	} else if seconds == 1 {
+		return "1 second"
+	} else if seconds < 60 {
+		return fmt.Sprintf("%d seconds", seconds)
+	} else if minutes := int(d.Minutes()); minutes == 1 {
+		return "About a minute"
+	} else if minutes < 60 {
+		return fmt.Sprintf("%d minutes", minutes)
+	} else if hours := int(math.Round(d.Hours())); hours == 1 {
+		return "About an hour"
+	} else if hours < 48 {
+		return fmt.Sprintf("%d hours", hours)
+	} else if hours < 24*7*2 {
+		return fmt.Sprintf("%d days", hours/24)
+	} else if hours < 24*30*2 {
+		return fmt.Sprintf("%d weeks", hours/24/7)
+	} else if hours < 24*365*2 {
+		return fmt.Sprintf("%d months", hours/24/30)
+	}
+	return fmt.Sprintf("%d years", int(d.Hours())/24/365)
+}
+
+// Since 计算 time.DateTime 格式的本地时间到现在的时间间隔
+func Since(dateTime string) (time.Duration, error) {
+	t, err := time.ParseInLocation(time.DateTime, dateTime, time.Local)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(t), nil
+}
@@ -0,0 +1,15 @@
+package volume
+
+const (
+	// DataRoot mydocker 持久化数据的根目录
+	DataRoot = "/var/lib/mydocker/"
+	// configName 数据卷配置文件名
+	configName = "volume.json"
+	// dataDirName 数据卷中保存数据的目录，挂载到容器中的就是这个目录
+	dataDirName = "_data"
+	// anonymousNameLength 匿名数据卷名字的长度
+	anonymousNameLength = 32
+)
+
+// volumeRoot 数据卷的存储目录，每个数据卷一个子目录 {volumeRoot}/{name}/
+var volumeRoot = DataRoot + "volumes/"
@@ -0,0 +1,232 @@
+package volume
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/pjimming/mydocker/container"
+	"github.com/pjimming/mydocker/utils/jsonx"
+)
+
+// nameRegexp 数据卷名与 docker 的规则一致
+var nameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// containerExists 判断容器是否还存在，用于忽略已经被删除的容器留下的引用
+var containerExists = func(containerId string) bool {
+	_, err := os.Stat(path.Join(container.InfoLoc, containerId, container.ConfigName))
+	return err == nil
+}
+
+// Volume 由 mydocker 管理的命名数据卷或匿名数据卷
+type Volume struct {
+	Name       string   `json:"name"`       // 数据卷名
+	Mountpoint string   `json:"mountpoint"` // 数据卷在宿主机上的目录
+	CreatedAt  string   `json:"createdAt"`  // 创建时间
+	Anonymous  bool     `json:"anonymous"`  // 是否是匿名数据卷
+	Containers []string `json:"containers"` // 引用该数据卷的容器Id
+}
+
+// InUse 数据卷是否被仍然存在的容器引用
+func (v *Volume) InUse() bool {
+	for _, containerId := range v.Containers {
+		if containerExists(containerId) {
+			return true
+		}
+	}
+	return false
+}
+
+func getVolumeDir(name string) string {
+	return path.Join(volumeRoot, name)
+}
+
+// validateName 校验数据卷名，数据卷名会拼接到路径中，不能包含 / 或者是 ..
+func validateName(name string) error {
+	if !nameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid volume name %s, only [a-zA-Z0-9][a-zA-Z0-9_.-] are allowed", name)
+	}
+	return nil
+}
+
+// Create 创建数据卷，name 为空时创建匿名数据卷，同名数据卷已经存在时直接返回
+func Create(name string) (*Volume, error) {
+	anonymous := name == ""
+	if anonymous {
+		name = newAnonymousName()
+	}
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	if v, err := Get(name); err == nil {
+		return v, nil
+	}
+
+	v := &Volume{
+		Name:       name,
+		Mountpoint: path.Join(getVolumeDir(name), dataDirName),
+		CreatedAt:  time.Now().Format(time.DateTime),
+		Anonymous:  anonymous,
+	}
+	if err := os.MkdirAll(v.Mountpoint, 0755); err != nil {
+		logrus.Errorf("[Create] mkdir %s fail, %v", v.Mountpoint, err)
+		return nil, err
+	}
+	if err := v.dump(); err != nil {
+		logrus.Errorf("[Create] dump volume %s fail, %v", name, err)
+		return nil, err
+	}
+	return v, nil
+}
+
+// Get 根据名字读取数据卷
+func Get(name string) (*Volume, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	v := new(Volume)
+	if err := jsonx.ReadJsonFile(path.Join(getVolumeDir(name), configName), v); err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no such volume: %s", name)
+		}
+		return nil, err
+	}
+	return v, nil
+}
+
+// List 读取所有数据卷，按名字排序
+func List() ([]*Volume, error) {
+	dirs, err := os.ReadDir(volumeRoot)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	volumes := make([]*Volume, 0, len(dirs))
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		v, err := Get(dir.Name())
+		if err != nil {
+			logrus.Errorf("[List] read volume %s fail, %v", dir.Name(), err)
+			continue
+		}
+		volumes = append(volumes, v)
+	}
+	sort.Slice(volumes, func(i, j int) bool {
+		return volumes[i].Name < volumes[j].Name
+	})
+	return volumes, nil
+}
+
+// Remove 删除数据卷及其中的数据，被容器引用的数据卷不能删除
+func Remove(name string) error {
+	return update(name, func(v *Volume) error {
+		if v.InUse() {
+			return fmt.Errorf("volume %s is in use by %v", name, v.Containers)
+		}
+		return os.RemoveAll(getVolumeDir(name))
+	})
+}
+
+// Prune 删除没有被容器引用的匿名数据卷，all 为 true 时同时删除命名数据卷，返回删除的数据卷名
+func Prune(all bool) ([]string, error) {
+	volumes, err := List()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, v := range volumes {
+		if v.InUse() || (!all && !v.Anonymous) {
+			continue
+		}
+		if err = Remove(v.Name); err != nil {
+			logrus.Errorf("[Prune] remove volume %s fail, %v", v.Name, err)
+			continue
+		}
+		removed = append(removed, v.Name)
+	}
+	return removed, nil
+}
+
+// Acquire 记录容器对数据卷的引用
+func Acquire(name, containerId string) error {
+	return update(name, func(v *Volume) error {
+		for _, id := range v.Containers {
+			if id == containerId {
+				return nil
+			}
+		}
+		v.Containers = append(v.Containers, containerId)
+		return v.dump()
+	})
+}
+
+// Release 删除容器对数据卷的引用
+func Release(name, containerId string) error {
+	return update(name, func(v *Volume) error {
+		containers := v.Containers[:0]
+		for _, id := range v.Containers {
+			if id != containerId {
+				containers = append(containers, id)
+			}
+		}
+		v.Containers = containers
+		return v.dump()
+	})
+}
+
+// update 读取数据卷信息交给 fn 处理，处理期间对数据卷目录加文件锁，避免并发修改引用计数
+func update(name string, fn func(v *Volume) error) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	dir, err := os.Open(getVolumeDir(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no such volume: %s", name)
+		}
+		return err
+	}
+	defer func() {
+		_ = dir.Close()
+	}()
+	if err = syscall.Flock(int(dir.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer func() {
+		_ = syscall.Flock(int(dir.Fd()), syscall.LOCK_UN)
+	}()
+
+	v, err := Get(name)
+	if err != nil {
+		return err
+	}
+	return fn(v)
+}
+
+func (v *Volume) dump() error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(getVolumeDir(v.Name), configName), content, 0644)
+}
+
+// newAnonymousName 生成匿名数据卷的随机名字
+func newAnonymousName() string {
+	b := make([]byte, anonymousNameLength/2)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
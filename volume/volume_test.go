@@ -0,0 +1,84 @@
+package volume
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolume(t *testing.T) {
+	ast := assert.New(t)
+	volumeRoot = t.TempDir()
+	existing := map[string]bool{}
+	containerExists = func(containerId string) bool {
+		return existing[containerId]
+	}
+
+	_, err := Create("-bad")
+	ast.NotNil(err)
+
+	data, err := Create("data")
+	ast.Nil(err)
+	ast.DirExists(data.Mountpoint)
+	again, err := Create("data")
+	ast.Nil(err)
+	ast.Equal(data.CreatedAt, again.CreatedAt)
+
+	anonymous, err := Create("")
+	ast.Nil(err)
+	ast.True(anonymous.Anonymous)
+	ast.Len(anonymous.Name, anonymousNameLength)
+
+	// 被容器引用的数据卷不能删除
+	existing["1234567890"] = true
+	ast.Nil(Acquire("data", "1234567890"))
+	ast.Nil(Acquire("data", "1234567890"))
+	data, err = Get("data")
+	ast.Nil(err)
+	ast.Equal([]string{"1234567890"}, data.Containers)
+	ast.NotNil(Remove("data"))
+
+	// 容器已经不存在时忽略它的引用
+	existing["1234567890"] = false
+	ast.False(data.InUse())
+	existing["1234567890"] = true
+
+	removed, err := Prune(false)
+	ast.Nil(err)
+	ast.Equal([]string{anonymous.Name}, removed)
+
+	ast.Nil(Release("data", "1234567890"))
+	ast.Nil(Remove("data"))
+	_, err = Get("data")
+	ast.NotNil(err)
+	ast.NotNil(Remove("data"))
+
+	volumes, err := List()
+	ast.Nil(err)
+	ast.Empty(volumes)
+}
+
+func TestVolume_InvalidName(t *testing.T) {
+	ast := assert.New(t)
+	root := t.TempDir()
+	volumeRoot = path.Join(root, "volumes")
+	containerExists = func(containerId string) bool {
+		return false
+	}
+
+	// 数据卷目录之外的目录，不能通过 ../ 删除或者修改
+	victim := path.Join(root, "victim")
+	ast.Nil(os.MkdirAll(victim, 0755))
+	ast.Nil(os.WriteFile(path.Join(victim, configName), []byte(`{"name":"victim"}`), 0644))
+
+	for _, name := range []string{"../victim", "..", "a/b", "/tmp"} {
+		_, err := Get(name)
+		ast.NotNil(err, name)
+		ast.NotNil(Remove(name), name)
+		ast.NotNil(Acquire(name, "1234567890"), name)
+		ast.NotNil(Release(name, "1234567890"), name)
+	}
+	ast.FileExists(path.Join(victim, configName))
+}